@@ -0,0 +1,614 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/clarketm/pj/pkg/cli"
+	pjerrors "github.com/clarketm/pj/pkg/errors"
+	"github.com/clarketm/pj/pkg/prow"
+	"github.com/clarketm/pj/pkg/source"
+)
+
+var branchShort = "Fork job configuration for a new release branch"
+
+var branchLong = `Fork job configuration for a new release branch
+
+Every job running on the source branch gets a copy targeting the new branch, inserted after it in the same input
+file. The copy pins the image resolved for the source branch as it is written, by tag or digest; digests are not
+looked up in the registry. It rewrites extra_repos refs on the source branch to the new branch, keeps the branch
+override applying to the new branch, and writes its jobs to a separate output file per branch. The input files are
+rewritten in place; generated job files are not touched.
+
+# Fork the jobs of master for release-1.8.
+pj branch -g ./examples/global1.yaml -i ./examples/jobs.yaml --from master --to release-1.8
+
+# Report the jobs which would be copied without rewriting the input files.
+pj branch -g ./examples/global1.yaml -i ./examples/jobs.yaml --to release-1.8 --dry-run
+`
+
+// branchCmd represents the branch command
+var branchCmd = &cobra.Command{
+	Use:   "branch",
+	Short: branchShort,
+	Long:  branchLong,
+	RunE:  branch,
+}
+
+func init() {
+	rootCmd.AddCommand(branchCmd)
+	addResolveFlags(branchCmd, "")
+	branchCmd.Flags().String("from", prow.DefaultBranch, "Branch whose jobs are copied.")
+	branchCmd.Flags().String("to", "", "New branch targeted by the copied jobs.")
+	branchCmd.Flags().String("name-suffix", prow.DefaultBranchSuffix, "Suffix appended to the names of the copied jobs, executed for the new branch.")
+	branchCmd.Flags().Bool("dry-run", false, "Report the copied jobs without rewriting the input files.")
+	_ = branchCmd.MarkFlagRequired("to")
+}
+
+// branchOptions control how jobs are copied to a new branch.
+type branchOptions struct {
+	From       string
+	To         string
+	NameSuffix string
+}
+
+func branch(cmd *cobra.Command, args []string) error {
+	opts, err := getResolveOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	var bo branchOptions
+
+	if bo.From, err = cmd.Flags().GetString("from"); err != nil {
+		return errors.Wrapf(err, "getting from flag")
+	}
+
+	if bo.To, err = cmd.Flags().GetString("to"); err != nil {
+		return errors.Wrapf(err, "getting to flag")
+	}
+
+	if bo.NameSuffix, err = cmd.Flags().GetString("name-suffix"); err != nil {
+		return errors.Wrapf(err, "getting name-suffix flag")
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return errors.Wrapf(err, "getting dry-run flag")
+	}
+
+	if bo.From == bo.To {
+		return fmt.Errorf("--from and --to are the same branch: %s", bo.From)
+	}
+
+	globalConfig, diags := loadProfileGlobal(opts)
+
+	rawJobs, idiags := readJobs(opts.Input, opts.Strict)
+	diags = append(diags, idiags...)
+
+	inputJobs, idiags := extendJobs(rawJobs)
+	diags = append(diags, idiags...)
+
+	if diags.HasErrors() {
+		return diags
+	}
+
+	// Resolve every job to find the branches it runs on.
+	var resolved = make([]cli.Job, len(inputJobs))
+	var existing = sets.String{}
+	var bySource = make(map[string][]int)
+
+	for i, ij := range inputJobs {
+		job, err := ij.Job.DeepCopy()
+		if err == nil {
+			err = prow.ResolveJob(ij.log(), &job, ij.Defaults, globalConfig)
+		}
+		if err != nil {
+			diags.Add(ij.diagnostic(), err)
+			continue
+		}
+		prow.SetDefaults(&job)
+
+		resolved[i] = job
+		bySource[ij.Source] = append(bySource[ij.Source], i)
+
+		for _, b := range job.Branches {
+			name, err := branchTemplate(job, job.Name, b)
+			if err != nil {
+				name = job.Name
+			}
+			existing.Insert(branchKey(job.OrgRepo, name, b))
+		}
+	}
+
+	// Decide which jobs are copied first, so that copies extend the copies of their parents.
+	var copied = make(map[int]string)
+
+	for i, ij := range inputJobs {
+		job := resolved[i]
+		if !sets.NewString(job.Branches...).Has(bo.From) {
+			continue
+		}
+
+		name, err := copyName(job, bo)
+		if err != nil {
+			diags.Add(ij.diagnostic(), err)
+			continue
+		}
+
+		if !existing.Has(branchKey(job.OrgRepo, name, bo.To)) {
+			copied[i] = name
+		}
+	}
+
+	for _, src := range prow.SortedKeys(bySource) {
+		b, err := ioutil.ReadFile(src)
+		if err != nil {
+			diags.Add(pjerrors.Diagnostic{File: src}, errors.Wrapf(err, "reading input path"))
+			continue
+		}
+
+		file := source.Parse(src, b)
+
+		var copies []branchCopy
+
+		for _, i := range bySource[src] {
+			name, ok := copied[i]
+			if !ok {
+				continue
+			}
+
+			var extends string
+			if rawJobs[i].Job.Extends != "" {
+				if parent, err := findJob(rawJobs, i); err == nil && copied[parent] != "" {
+					extends = strings.TrimSuffix(rawJobs[i].Job.Extends, rawJobs[parent].Job.Name) + copied[parent]
+				}
+			}
+
+			c, cdiags := copyJob(file, inputJobs[i], resolved[i], name, extends, bo)
+			diags = append(diags, cdiags...)
+			if c != nil {
+				copies = append(copies, *c)
+			}
+		}
+
+		if len(copies) == 0 {
+			continue
+		}
+
+		out, err := insertCopies(file, b, copies)
+		if err != nil {
+			diags.Add(pjerrors.Diagnostic{File: src}, err)
+			continue
+		}
+
+		for _, c := range copies {
+			logger.WithFields(logrus.Fields{"file": src, "line": c.Line, "job": c.Source, "branch": bo.To, "name": c.Name}).Info("Copied job.")
+		}
+
+		if dryRun {
+			continue
+		}
+
+		if err := ioutil.WriteFile(src, out, 0644); err != nil {
+			diags.Add(pjerrors.Diagnostic{File: src}, errors.Wrapf(err, "writing input path"))
+			continue
+		}
+		logger.WithField("file", src).Debug("Wrote file.")
+	}
+
+	return diags.Err()
+}
+
+// branchCopy is the copy of a job for a new branch, inserted after the job it was copied from.
+type branchCopy struct {
+	Source string
+	Name   string
+	Index  int
+	Line   int
+	Node   *yaml.Node
+}
+
+// copyJob builds the copy of a job for the new branch from the job's yaml node, so that its formatting and fields
+// are preserved. Only the fields depending on the branch are rewritten, using their resolved values, and a job
+// extending a copied job extends its copy instead.
+func copyJob(file *source.File, ij inputJob, job cli.Job, name, extends string, bo branchOptions) (*branchCopy, pjerrors.Diagnostics) {
+	var diags pjerrors.Diagnostics
+
+	node := file.Node("jobs", ij.Index)
+	if node == nil || node.Kind != yaml.MappingNode || node.Style&yaml.FlowStyle != 0 {
+		diags.Addf(ij.diagnostic(), "cannot copy job: only block style jobs can be rewritten")
+		return nil, diags
+	}
+
+	c := copyNode(node)
+	c.HeadComment, c.FootComment = "", ""
+	if len(c.Content) > 0 {
+		c.Content[0].HeadComment = ""
+	}
+
+	setKey(c, "name", scalarNode(name, 0))
+	if extends != "" {
+		setKey(c, "extends", scalarNode(extends, 0))
+	}
+	deleteKey(c, "branch")
+	deleteKey(c, "skip_branches")
+	if err := keepBranchOverride(c, name, bo.To); err != nil {
+		diags.Add(ij.diagnostic(), err)
+		return nil, diags
+	}
+	setKey(c, "branches", &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle, Content: []*yaml.Node{scalarNode(bo.To, 0)}})
+
+	// Pin the image resolved for the source branch.
+	onFrom, err := job.DeepCopy()
+	if err != nil {
+		diags.Add(ij.diagnostic(), err)
+		return nil, diags
+	}
+	onFrom.Branches = []string{bo.From}
+
+	expanded, err := prow.ExpandJob(onFrom)
+	if err != nil {
+		diags.Add(ij.diagnostic(), err)
+		return nil, diags
+	}
+
+	images := sets.String{}
+	for _, e := range expanded {
+		if e.Image != "" {
+			images.Insert(e.Image)
+		}
+	}
+
+	warning := pjerrors.Diagnostic{Severity: pjerrors.Warning, File: ij.Source, Line: ij.Line, Column: ij.Column, Job: ij.Job.Name}
+
+	switch images.Len() {
+	case 0:
+	case 1:
+		image := images.List()[0]
+		setKey(c, "image", scalarNode(image, 0))
+		if floatingImage(image, bo.From) {
+			diags.Addf(warning, "image %s is not pinned to a tag or digest", image)
+		}
+	default:
+		diags.Addf(warning, "image differs between the jobs generated by the job and is not pinned")
+	}
+
+	// Rewrite refs on the source branch.
+	var repos []cli.ExtraRepo
+	var rewritten bool
+	for _, repo := range job.ExtraRepos {
+		r := rewriteRef(repo, bo.From, bo.To)
+		rewritten = rewritten || r != repo
+		repos = append(repos, r)
+	}
+
+	if rewritten {
+		var style yaml.Style
+		if n := keyValue(node, "extra_repos"); n == nil || n.Style&yaml.FlowStyle != 0 {
+			style = yaml.FlowStyle
+		}
+
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Style: style}
+		for _, r := range repos {
+			seq.Content = append(seq.Content, extraRepoNode(r))
+		}
+		setKey(c, "extra_repos", seq)
+	}
+
+	setKey(c, "output_tmpl", scalarNode(branchOutputTemplate(job.OutputTemplate), yaml.DoubleQuotedStyle))
+
+	return &branchCopy{Source: ij.Job.Name, Name: name, Index: ij.Index, Line: ij.Line, Node: c}, diags
+}
+
+// keepBranchOverride keeps only the branch override of a copy applying to the new branch, if any. The override is
+// named like the copy, so that the job it generates replaces the copy rather than being named with the branch suffix.
+func keepBranchOverride(c *yaml.Node, name, to string) error {
+	overrides := keyValue(c, "branch_overrides")
+	if overrides == nil || overrides.Kind != yaml.MappingNode {
+		deleteKey(c, "branch_overrides")
+		return nil
+	}
+
+	var keys = make(map[string]cli.Job)
+	for i := 0; i+1 < len(overrides.Content); i += 2 {
+		keys[overrides.Content[i].Value] = cli.Job{}
+	}
+
+	key, err := prow.BranchOverride(keys, to)
+	if err != nil {
+		return err
+	} else if key == "" {
+		deleteKey(c, "branch_overrides")
+		return nil
+	}
+
+	for i := 0; i+1 < len(overrides.Content); i += 2 {
+		if overrides.Content[i].Value != key {
+			continue
+		}
+
+		override := overrides.Content[i+1]
+		if override.Kind == yaml.MappingNode && keyValue(override, "name") == nil {
+			override.Content = append([]*yaml.Node{scalarNode("name", 0), scalarNode(name, 0)}, override.Content...)
+		}
+		overrides.Content = []*yaml.Node{overrides.Content[i], override}
+		break
+	}
+
+	return nil
+}
+
+// insertCopies inserts each copy after the last line of the job it was copied from.
+func insertCopies(src *source.File, b []byte, copies []branchCopy) ([]byte, error) {
+	lines := strings.SplitAfter(string(b), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		lines[len(lines)-1] += "\n"
+	}
+
+	jobs := src.Node("jobs")
+	if jobs == nil || jobs.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("cannot copy jobs: jobs must be a block style list")
+	}
+
+	// The jobs end before the first top-level key following them, if any.
+	end := len(lines) + 1
+	if root := src.Node(); root != nil {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if k := root.Content[i]; k.Line > jobs.Line && k.Line < end {
+				end = k.Line
+			}
+		}
+	}
+
+	sort.Slice(copies, func(i, j int) bool { return copies[i].Index > copies[j].Index })
+
+	for _, c := range copies {
+		item := jobs.Content[c.Index]
+
+		next := end
+		if c.Index+1 < len(jobs.Content) {
+			next = jobs.Content[c.Index+1].Line
+		}
+
+		// Insert after the last line of the job, before any blank lines and comments preceding the next one.
+		last := next - 1
+		for last > item.Line && isBlankOrComment(lines[last-1]) {
+			last--
+		}
+
+		text, err := encodeItem(c.Node, item.Column-3)
+		if err != nil {
+			return nil, err
+		}
+
+		inserted := append([]string{}, lines[:last]...)
+		inserted = append(inserted, "\n", text)
+		lines = append(inserted, lines[last:]...)
+	}
+
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// encodeItem encodes a node as a block list item indented by the given number of spaces.
+func encodeItem(node *yaml.Node, indent int) (string, error) {
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{node}}); err != nil {
+		return "", errors.Wrapf(err, "encoding job")
+	}
+	if err := enc.Close(); err != nil {
+		return "", errors.Wrapf(err, "encoding job")
+	}
+
+	if indent <= 0 {
+		return buf.String(), nil
+	}
+
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if strings.TrimSpace(line) != "" {
+			out.WriteString(strings.Repeat(" ", indent))
+		}
+		out.WriteString(line)
+	}
+
+	return out.String(), nil
+}
+
+// branchOutputTemplate returns an output template writing jobs to a separate file per branch, inserting the branch
+// before the `.gen` or yaml extension of the file name unless the template already depends on the branch.
+func branchOutputTemplate(tmpl string) string {
+	if tmpl == "" {
+		tmpl = strings.TrimSuffix(prow.DefaultOutput, path.Ext(prow.DefaultOutput))
+	}
+
+	if strings.Contains(tmpl, ".Branch") {
+		return tmpl
+	}
+
+	for _, ext := range []string{".gen.yaml", ".gen.yml", ".gen", ".yaml", ".yml"} {
+		if strings.HasSuffix(tmpl, ext) {
+			return strings.TrimSuffix(tmpl, ext) + ".{{.Branch}}" + ext
+		}
+	}
+
+	return tmpl + ".{{.Branch}}"
+}
+
+// rewriteRef rewrites an extra repository ref on the source branch to the new branch. Refs without a branch are on
+// the default branch; repositories pinned to a SHA are left as they are.
+func rewriteRef(repo cli.ExtraRepo, from, to string) cli.ExtraRepo {
+	if repo.SHA == "" && (repo.Ref == from || (repo.Ref == "" && from == prow.DefaultBranch)) {
+		repo.Ref = to
+	}
+	return repo
+}
+
+// extraRepoNode returns the yaml node of an extra repository, in the short form if possible.
+func extraRepoNode(repo cli.ExtraRepo) *yaml.Node {
+	if repo.Short() {
+		return scalarNode(repo.String(), 0)
+	}
+
+	n := &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+	for _, kv := range [][2]string{
+		{"repo", repo.OrgRepo},
+		{"ref", repo.Ref},
+		{"sha", repo.SHA},
+		{"path_alias", repo.PathAlias},
+		{"clone_uri", repo.CloneURI},
+	} {
+		if kv[1] != "" {
+			n.Content = append(n.Content, scalarNode(kv[0], 0), scalarNode(kv[1], 0))
+		}
+	}
+	if repo.WorkDir {
+		n.Content = append(n.Content, scalarNode("workdir", 0), &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+	}
+
+	return n
+}
+
+// floatingImage reports whether an image has no tag or digest, or a tag which moves along with the branch.
+func floatingImage(image, from string) bool {
+	if strings.Contains(image, "@") {
+		return false
+	}
+
+	name := image[strings.LastIndex(image, "/")+1:]
+
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return true
+	}
+
+	tag := name[i+1:]
+	return tag == "latest" || tag == from
+}
+
+// copyName returns the name of the copy of a job for the new branch: the name suffix executed for the new branch is
+// appended to the name of the job, without the suffix of the source branch if the job is itself a copy, so that
+// suffixes do not stack.
+func copyName(job cli.Job, bo branchOptions) (string, error) {
+	fromSuffix, err := branchTemplate(job, bo.NameSuffix, bo.From)
+	if err != nil {
+		return "", errors.Wrapf(err, "name-suffix")
+	}
+
+	toSuffix, err := branchTemplate(job, bo.NameSuffix, bo.To)
+	if err != nil {
+		return "", errors.Wrapf(err, "name-suffix")
+	}
+
+	// Copies made before the suffix was executed are named with the suffix template itself.
+	base := strings.TrimSuffix(strings.TrimSuffix(job.Name, fromSuffix), bo.NameSuffix)
+
+	return base + toSuffix, nil
+}
+
+// branchTemplate executes a template of a job, such as its name or the name suffix, for one of its branches.
+func branchTemplate(job cli.Job, tmpl, branch string) (string, error) {
+	data := prow.NewTemplateData(&job)
+	data.Branch, data.Branches = branch, []string{branch}
+	return prow.ExecuteTemplate(job.Name, tmpl, data)
+}
+
+func branchKey(orgRepo, name, branch string) string {
+	return fmt.Sprintf("%s/%s@%s", orgRepo, name, branch)
+}
+
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = nil
+	for _, child := range n.Content {
+		c.Content = append(c.Content, copyNode(child))
+	}
+	return &c
+}
+
+func scalarNode(value string, style yaml.Style) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: style}
+}
+
+func keyValue(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setKey sets the value of a key in a mapping node, adding the key after the name if it is missing.
+func setKey(n *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = value
+			return
+		}
+	}
+
+	pos := len(n.Content)
+	if key == "branches" {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == "name" {
+				pos = i + 2
+			}
+		}
+	}
+
+	kv := []*yaml.Node{scalarNode(key, 0), value}
+	n.Content = append(n.Content[:pos], append(kv, n.Content[pos:]...)...)
+}
+
+func deleteKey(n *yaml.Node, key string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/clarketm/pj/pkg/cli"
+	"github.com/clarketm/pj/pkg/prow"
+)
+
+func TestCopyName(t *testing.T) {
+	tests := []struct {
+		name     string
+		job      string
+		from     string
+		to       string
+		suffix   string
+		expected string
+	}{
+		{name: "default suffix", job: "unit", from: "master", to: "release-1.8", expected: "unit-release-1.8"},
+		{name: "copy of a copy", job: "unit-release-1.8", from: "release-1.8", to: "release-1.9", expected: "unit-release-1.9"},
+		{name: "copy named with the suffix template", job: "unit-{{.Branch}}", from: "release-1.8", to: "release-1.9", expected: "unit-release-1.9"},
+		{name: "job named like its branch", job: "unit-master", from: "master", to: "release-1.8", expected: "unit-release-1.8"},
+		{name: "custom suffix", job: "unit", from: "master", to: "release-1.8", suffix: "-{{.Branch | replace \".\" \"-\"}}", expected: "unit-release-1-8"},
+		{name: "suffix without template", job: "unit", from: "master", to: "release-1.8", suffix: "-rc", expected: "unit-rc"},
+		{name: "copy with a suffix without template", job: "unit-rc", from: "release-1.8", to: "release-1.9", suffix: "-rc", expected: "unit-rc"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var job cli.Job
+			job.Name = tc.job
+			job.OrgRepo = "org/repo"
+			job.Branches = []string{tc.from}
+
+			bo := branchOptions{From: tc.from, To: tc.to, NameSuffix: tc.suffix}
+			if bo.NameSuffix == "" {
+				bo.NameSuffix = prow.DefaultBranchSuffix
+			}
+
+			name, err := copyName(job, bo)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, name)
+			}
+		})
+	}
+
+	var job cli.Job
+	job.Name = "unit"
+	if _, err := copyName(job, branchOptions{From: "master", To: "release-1.8", NameSuffix: "-{{.Branch"}); err == nil {
+		t.Errorf("expected an error for an invalid suffix")
+	}
+}
@@ -0,0 +1,341 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"sigs.k8s.io/yaml"
+
+	"github.com/clarketm/pj/pkg/cli"
+	pjerrors "github.com/clarketm/pj/pkg/errors"
+	osutil "github.com/clarketm/pj/pkg/os"
+	strutil "github.com/clarketm/pj/pkg/strings"
+)
+
+// pathAnnotation marks flags whose values are paths. Relative paths set in the config file are relative to the
+// directory of the config file rather than the current directory.
+const pathAnnotation = "pj_path"
+
+// markPathFlags marks the flags of a command whose values are paths.
+func markPathFlags(cmd *cobra.Command, names ...string) {
+	for _, name := range names {
+		if cmd.Flags().Lookup(name) != nil {
+			_ = cmd.Flags().SetAnnotation(name, pathAnnotation, []string{"true"})
+		}
+	}
+}
+
+// sharedConfigAnnotation marks commands which resolve jobs. They share the keys of the config file which are not under
+// the name of a command, such as `input`, while the other commands are only set by keys under their own name.
+const sharedConfigAnnotation = "pj_shared_config"
+
+// markSharedConfig marks a command as sharing the keys of the config file which are not under the name of a command.
+func markSharedConfig(cmd *cobra.Command) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[sharedConfigAnnotation] = "true"
+}
+
+// configKeys returns the config keys setting a flag of a command for a profile, in order of precedence.
+func configKeys(cmd *cobra.Command, profile, name string) []string {
+	_, shared := cmd.Annotations[sharedConfigAnnotation]
+
+	var keys []string
+	if profile != "" {
+		keys = append(keys, "profiles."+profile+"."+cmd.Name()+"."+name)
+		if shared {
+			keys = append(keys, "profiles."+profile+"."+name)
+		}
+	}
+
+	keys = append(keys, cmd.Name()+"."+name)
+	if shared {
+		keys = append(keys, name)
+	}
+
+	return keys
+}
+
+// configPaths returns the directories searched for the config file, nearest first: the current directory and its
+// parents up to the root of the git repository containing it, followed by the home directory.
+func configPaths() ([]string, error) {
+	var paths []string
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting current directory")
+	}
+
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		paths = append(paths, dir)
+
+		if osutil.Exists(filepath.Join(dir, ".git")) {
+			break
+		} else if dir == filepath.Dir(dir) {
+			// Outside of a repository, only the current directory is searched.
+			paths = paths[:1]
+			break
+		}
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting home directory")
+	}
+
+	return append(paths, home), nil
+}
+
+// Annotations recording the value of a flag before the config is applied, and whether it is set on the command line.
+const (
+	defaultAnnotation     = "pj_default"
+	commandLineAnnotation = "pj_command_line"
+)
+
+// applyConfig sets the flags of a command which are not set on the command line from the `PJ_*` environment
+// variables or the config file, using the profile selected by --profile, or by the `profile` key, if any.
+func applyConfig(cmd *cobra.Command) error {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			_ = cmd.Flags().SetAnnotation(f.Name, commandLineAnnotation, []string{"true"})
+		}
+		_ = cmd.Flags().SetAnnotation(f.Name, defaultAnnotation, flagValues(f))
+	})
+
+	var profile string
+	if f := cmd.Flags().Lookup("profile"); f != nil && f.Changed {
+		profile = f.Value.String()
+	} else if values, _, found := configValues(configKeys(cmd, "", "profile")); f != nil && found {
+		profile = values[0]
+	}
+
+	if all, _ := cmd.Flags().GetBool("all-profiles"); all && profile != "" {
+		return fmt.Errorf("--profile and --all-profiles cannot both be set")
+	}
+
+	return applyProfile(cmd, profile)
+}
+
+// applyProfile sets the flags of a command which are not set on the command line for a profile. The values of a
+// profile, such as `profiles.<name>.input`, take precedence over the values for every profile, and a value under the
+// name of the command, such as `create.output`, over a value for every command. Values for every command only apply
+// to commands which resolve jobs. Environment variables take precedence over the config file. Flags set by none of
+// them are reset to their default.
+func applyProfile(cmd *cobra.Command, profile string) error {
+	var errorList error
+
+	if profile != "" && !viper.IsSet("profiles."+profile) {
+		return unknownProfile(profile)
+	}
+
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if len(f.Annotations[commandLineAnnotation]) > 0 || f.Name == "config" || f.Name == "all-profiles" {
+			return
+		}
+
+		if f.Name == "profile" {
+			_ = setFlag(f, []string{profile}, false)
+			return
+		}
+
+		values, fromFile, found := configValues(configKeys(cmd, profile, f.Name))
+		if !found {
+			values = f.Annotations[defaultAnnotation]
+		}
+
+		if err := setFlag(f, values, fromFile); err != nil {
+			errorList = multierror.Append(errorList, errors.Wrapf(err, "setting %s from config", f.Name))
+		}
+	})
+
+	return errorList
+}
+
+// configValues returns the value of the first key set by an environment variable or, failing that, the first key set
+// in the config file. List values are returned item by item.
+func configValues(keys []string) ([]string, bool, bool) {
+	for _, key := range keys {
+		if value, exists := os.LookupEnv(envVar(key)); exists {
+			return []string{value}, false, true
+		}
+	}
+
+	for _, key := range keys {
+		if !viper.IsSet(key) {
+			continue
+		}
+
+		switch v := viper.Get(key).(type) {
+		case []interface{}:
+			var values []string
+			for _, item := range v {
+				values = append(values, fmt.Sprint(item))
+			}
+			return values, true, true
+		default:
+			return []string{fmt.Sprint(v)}, true, true
+		}
+	}
+
+	return nil, false, false
+}
+
+// setFlag replaces the value of a flag. Relative paths set in the config file are made relative to its directory.
+func setFlag(f *pflag.Flag, values []string, fromFile bool) error {
+	if fromFile && len(f.Annotations[pathAnnotation]) > 0 {
+		for i, value := range values {
+			if value != "" && !filepath.IsAbs(value) {
+				values[i] = filepath.Join(filepath.Dir(viper.ConfigFileUsed()), value)
+			}
+		}
+	}
+
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		var items []string
+		for _, value := range values {
+			// A list set by an environment variable is comma separated.
+			items = append(items, strings.Split(value, ",")...)
+		}
+		return slice.Replace(items)
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+	return f.Value.Set(values[0])
+}
+
+// flagValues returns the current value of a flag, item by item for lists.
+func flagValues(f *pflag.Flag) []string {
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		return slice.GetSlice()
+	}
+	return []string{f.Value.String()}
+}
+
+// envVar returns the environment variable of a config key.
+func envVar(key string) string {
+	return "PJ_" + envKeyReplacer.Replace(strings.ToUpper(key))
+}
+
+var envKeyReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+// profileNames returns the names of the profiles defined in the config file.
+func profileNames() []string {
+	var names []string
+	for name := range viper.GetStringMap("profiles") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func unknownProfile(name string) error {
+	names := profileNames()
+	if len(names) == 0 {
+		return fmt.Errorf("unknown profile: %s (no profiles are defined)", name)
+	}
+
+	msg := fmt.Sprintf("unknown profile: %s", name)
+	if closest := strutil.Closest(name, names); closest != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", closest)
+	}
+	return fmt.Errorf("%s (available: %s)", msg, strings.Join(names, ", "))
+}
+
+// runProfiles runs a command once for every profile with --all-profiles, and once otherwise. The problems of every
+// profile are reported together.
+func runProfiles(cmd *cobra.Command, run func(cmd *cobra.Command) error) error {
+	if all, err := cmd.Flags().GetBool("all-profiles"); err != nil {
+		return errors.Wrapf(err, "getting all-profiles flag")
+	} else if !all {
+		return run(cmd)
+	}
+
+	names := profileNames()
+	if len(names) == 0 {
+		return fmt.Errorf("--all-profiles: no profiles are defined")
+	}
+
+	var diags pjerrors.Diagnostics
+
+	for _, name := range names {
+		if err := applyProfile(cmd, name); err != nil {
+			return errors.Wrapf(err, "profile %s", name)
+		}
+
+		if err := run(cmd); err != nil {
+			if _, ok := err.(pjerrors.Diagnostics); !ok {
+				err = errors.Wrapf(err, "profile %s", name)
+			}
+			diags.Add(pjerrors.Diagnostic{}, err)
+		}
+	}
+
+	return diags.Err()
+}
+
+// profileDefaults returns the job defaults of a profile. They are read from the config file directly, since viper
+// does not preserve the case of keys.
+func profileDefaults(profile string) (cli.Job, error) {
+	var config struct {
+		Profiles map[string]struct {
+			Defaults cli.Job `json:"defaults"`
+		} `json:"profiles"`
+	}
+
+	if profile == "" || viper.ConfigFileUsed() == "" {
+		return cli.Job{}, nil
+	}
+
+	b, err := ioutil.ReadFile(viper.ConfigFileUsed())
+	if err != nil {
+		return cli.Job{}, errors.Wrapf(err, "reading config file")
+	}
+
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return cli.Job{}, errors.Wrapf(err, "unmarshal config file")
+	}
+
+	// Profile names are case insensitive, like every other config key.
+	for name, p := range config.Profiles {
+		if strings.EqualFold(name, profile) {
+			return p.Defaults, nil
+		}
+	}
+
+	return cli.Job{}, nil
+}
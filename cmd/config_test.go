@@ -0,0 +1,140 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		shared  bool
+		config  map[string]interface{}
+		env     map[string]string
+		input   []string
+		output  string
+	}{
+		{
+			name:    "shared keys",
+			command: "create",
+			shared:  true,
+			config:  map[string]interface{}{"input": []interface{}{"jobs"}, "output": "out"},
+			input:   []string{"jobs"},
+			output:  "out",
+		},
+		{
+			name:    "command keys take precedence",
+			command: "create",
+			shared:  true,
+			config:  map[string]interface{}{"output": "out", "create": map[string]interface{}{"output": "create"}},
+			input:   []string{"/dev/stdin"},
+			output:  "create",
+		},
+		{
+			name:    "shared keys do not apply to import",
+			command: "import",
+			config:  map[string]interface{}{"input": []interface{}{"jobs"}, "output": "out"},
+			input:   []string{"/dev/stdin"},
+			output:  "/dev/stdout",
+		},
+		{
+			name:    "command keys apply to import",
+			command: "import",
+			config:  map[string]interface{}{"output": "out", "import": map[string]interface{}{"input": []interface{}{"prow"}}},
+			input:   []string{"prow"},
+			output:  "/dev/stdout",
+		},
+		{
+			name:    "shared environment variables do not apply to branch",
+			command: "branch",
+			env:     map[string]string{"PJ_INPUT": "jobs", "PJ_BRANCH_OUTPUT": "out"},
+			input:   []string{"/dev/stdin"},
+			output:  "out",
+		},
+		{
+			name:    "shared profile keys do not apply to branch",
+			command: "branch",
+			config: map[string]interface{}{
+				"profile":  "public",
+				"profiles": map[string]interface{}{"public": map[string]interface{}{"input": []interface{}{"jobs"}}},
+			},
+			input:  []string{"/dev/stdin"},
+			output: "/dev/stdout",
+		},
+		{
+			name:    "profile keys",
+			command: "list",
+			shared:  true,
+			config: map[string]interface{}{
+				"profile":  "public",
+				"input":    []interface{}{"jobs"},
+				"profiles": map[string]interface{}{"public": map[string]interface{}{"input": []interface{}{"public"}}},
+			},
+			input:  []string{"public"},
+			output: "/dev/stdout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			for key, value := range tt.config {
+				viper.Set(key, value)
+			}
+
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			cmd := &cobra.Command{Use: tt.command}
+			cmd.Flags().StringSlice("input", []string{"/dev/stdin"}, "")
+			cmd.Flags().String("output", "/dev/stdout", "")
+			cmd.Flags().String("profile", "", "")
+			if tt.shared {
+				markSharedConfig(cmd)
+			}
+
+			if err := applyConfig(cmd); err != nil {
+				t.Fatalf("applyConfig() error = %v", err)
+			}
+
+			input, _ := cmd.Flags().GetStringSlice("input")
+			output, _ := cmd.Flags().GetString("output")
+			if !reflect.DeepEqual(input, tt.input) {
+				t.Errorf("input = %v, want %v", input, tt.input)
+			}
+			if output != tt.output {
+				t.Errorf("output = %q, want %q", output, tt.output)
+			}
+		})
+	}
+}
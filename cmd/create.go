@@ -23,21 +23,22 @@
 package cmd
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 
-	"github.com/imdario/mergo"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	prowapi "k8s.io/test-infra/prow/config"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/yaml"
 
-	"github.com/hashicorp/go-multierror"
-
 	"github.com/clarketm/pj/pkg/cli"
+	pjerrors "github.com/clarketm/pj/pkg/errors"
 	osutil "github.com/clarketm/pj/pkg/os"
 	"github.com/clarketm/pj/pkg/prow"
+	"github.com/clarketm/pj/pkg/source"
 )
 
 var createShort = "Create ProwJob yaml configuration"
@@ -50,6 +51,9 @@ pj create -g ./examples/global1.yaml -i ./examples/jobs.yaml -o ./jobs
 # Create ProwJobs using long options.
 pj create --global ./examples/global1.yaml --input ./examples/jobs.yaml --output ./jobs
 
+# Create ProwJobs and validate them using Prow's config loader before writing.
+pj create -g ./examples/global1.yaml -i ./examples/jobs.yaml -o ./jobs --validate
+
 # Create ProwJobs using input from stdin and ouput to stdout.
 pj create
 `
@@ -64,198 +68,486 @@ var createCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(createCmd)
-	createCmd.Flags().StringSliceP("global", "g", []string{}, "Global configuration files.")
-	createCmd.Flags().StringSliceP("input", "i", []string{"/dev/stdin"}, "Input files and/or directories.")
-	createCmd.Flags().StringP("output", "o", "/dev/stdout", "Output directory.")
-	createCmd.Flags().StringP("sort", "s", "asc", "Sort jobs (asc|desc).")
+	addResolveFlags(createCmd, "/dev/stdout")
+	markSharedConfig(createCmd)
+	addProfilesFlag(createCmd)
+	createCmd.Flags().StringP("sort", "s", "asc", "Sort jobs (asc|desc|source).")
+	createCmd.Flags().Bool("validate", false, "Validate jobs using Prow's config loader before writing.")
+	createCmd.Flags().String("prow-config", "", "Prow configuration file used for validation.")
+	markPathFlags(createCmd, "prow-config")
 }
 
 func create(cmd *cobra.Command, args []string) error {
-	var globalConfig cli.Job
-	var prowjobs = make(map[string]*prow.ProwJobConfig)
-	var errorList error
+	return runProfiles(cmd, createProfile)
+}
 
-	global, err := cmd.Flags().GetStringSlice("global")
+// createProfile runs the create command for the active profile.
+func createProfile(cmd *cobra.Command) error {
+	opts, err := getResolveOptions(cmd)
 	if err != nil {
-		return errors.Wrapf(err, "getting global flag")
+		return err
 	}
 
-	input, err := cmd.Flags().GetStringSlice("input")
+	sortFlag, err := cmd.Flags().GetString("sort")
 	if err != nil {
-		return errors.Wrapf(err, "getting input flag")
+		return errors.Wrapf(err, "getting sort flag")
 	}
 
-	output, err := cmd.Flags().GetString("output")
+	sort, err := prow.ParseSortOrder(sortFlag)
 	if err != nil {
-		return errors.Wrapf(err, "getting output flag")
+		return errors.Wrapf(err, "parsing sort flag")
 	}
 
-	sort, err := cmd.Flags().GetString("sort")
+	validate, err := cmd.Flags().GetBool("validate")
 	if err != nil {
-		return errors.Wrapf(err, "getting sort flag")
+		return errors.Wrapf(err, "getting validate flag")
 	}
 
-	// Process output directory.
-	if output, err = filepath.Abs(output); err != nil {
-		return errors.Wrapf(err, "getting output path: %s", output)
+	prowConfig, err := cmd.Flags().GetString("prow-config")
+	if err != nil {
+		return errors.Wrapf(err, "getting prow-config flag")
 	}
 
-	// Process global configuration files.
+	jobs, diags := resolveJobs(opts)
+	if odiags := checkRepoConfigOutput(jobs, opts.Output); odiags.HasErrors() {
+		return append(diags, odiags...)
+	}
+
+	prowjobs, bdiags := buildJobs(jobs)
+	diags = append(diags, bdiags...)
+
+	if validate {
+		vdiags := validateJobs(jobs, prowjobs, prowConfig)
+		diags = append(diags, vdiags...)
+		if vdiags.HasErrors() {
+			return diags
+		}
+	}
+
+	diags = append(diags, writeJobs(prowjobs, sort)...)
+
+	return diags.Err()
+}
+
+// resolvedJob is a job with all global, default and requirement configuration merged in.
+type resolvedJob struct {
+	*cli.Job
+	Source string
+	Line   int
+	Column int
+	Output string
+	// Presets is the path the presets of the job are written to.
+	Presets string
+	// ProwConfig and PluginConfig are the paths the Prow and plugin configuration of the job's repository are
+	// written to, if any.
+	ProwConfig   string
+	PluginConfig string
+}
+
+// diagnostic returns a diagnostic template locating the job.
+func (j resolvedJob) diagnostic() pjerrors.Diagnostic {
+	return pjerrors.Diagnostic{File: j.Source, Line: j.Line, Column: j.Column, Job: j.Name}
+}
+
+// loadGlobal reads the global configuration files and merges them into a single job.
+func loadGlobal(global []string, strict bool) (cli.Job, pjerrors.Diagnostics) {
+	var globalConfig cli.Job
+	var diags pjerrors.Diagnostics
+	var err error
+
 	for i, g := range global {
 
 		if global[i], err = filepath.Abs(g); err != nil {
-			errorList = multierror.Append(errors.Wrapf(err, "getting global path: %s", global[i]))
+			diags.Add(pjerrors.Diagnostic{File: g}, errors.Wrapf(err, "getting global path"))
 			continue
 		}
 
 		if !osutil.Exists(global[i]) {
-			errorList = multierror.Append(errors.Wrapf(err, "global path exists: %s", global[i]))
+			diags.Addf(pjerrors.Diagnostic{File: global[i]}, "global path does not exist")
 			continue
 		}
 
 		f, err := ioutil.ReadFile(global[i])
 		if err != nil {
-			errorList = multierror.Append(errors.Wrapf(err, "reading global path: %s", global[i]))
+			diags.Add(pjerrors.Diagnostic{File: global[i]}, errors.Wrapf(err, "reading global path"))
 			continue
 		}
 
 		var gc cli.JobConfiguration
 		if err := yaml.Unmarshal(f, &gc); err != nil {
-			errorList = multierror.Append(errors.Wrapf(err, "unmarshal global config: %s", global[i]))
+			diags.Add(pjerrors.Diagnostic{File: global[i], Line: source.ErrorLine(err)}, errors.Wrapf(err, "unmarshal global config"))
 			continue
 		}
 
-		if err := mergo.Merge(&globalConfig, cli.Job(gc.Defaults)); err != nil {
-			errorList = multierror.Append(errors.Wrapf(err, "merge global config: %s", global[i]))
+		diags = append(diags, checkFields(source.Parse(global[i], f), strict)...)
+
+		logger.WithFields(logrus.Fields{"layer": "global", "file": global[i]}).Debug("Merging layer.")
+		if err := prow.MergeFields(&globalConfig, cli.Job(gc.Defaults)); err != nil {
+			diags.Add(pjerrors.Diagnostic{File: global[i]}, errors.Wrapf(err, "merge global config"))
 			continue
 		}
 	}
 
-	// Process input configuration files and defaults.
+	return globalConfig, diags
+}
+
+// loadProfileGlobal reads the global configuration files and merges the defaults of the profile, if any, into them.
+// The defaults of the profile take precedence over the global configuration files.
+func loadProfileGlobal(opts resolveOptions) (cli.Job, pjerrors.Diagnostics) {
+	globalConfig, diags := loadGlobal(opts.Global, opts.Strict)
+	if opts.Profile == "" {
+		return globalConfig, diags
+	}
+
+	logger.WithFields(logrus.Fields{"layer": "profile", "profile": opts.Profile}).Debug("Merging layer.")
+	profileConfig, err := profileDefaults(opts.Profile)
+	if err == nil {
+		err = prow.MergeFields(&profileConfig, globalConfig)
+	}
+	if err != nil {
+		diags.Add(pjerrors.Diagnostic{}, errors.Wrapf(err, "profile %s", opts.Profile))
+		return globalConfig, diags
+	}
+
+	return profileConfig, diags
+}
+
+// readJobs reads the jobs defined by the input configuration files.
+func readJobs(input []string, strict bool) ([]inputJob, pjerrors.Diagnostics) {
+	var jobs []inputJob
+	var diags pjerrors.Diagnostics
+	var err error
+
 	for i, j := range input {
 		if input[i], err = filepath.Abs(j); err != nil {
-			errorList = multierror.Append(errors.Wrapf(err, "getting input path: %s", input[i]))
+			diags.Add(pjerrors.Diagnostic{File: j}, errors.Wrapf(err, "getting input path"))
 			continue
 		}
 
 		if !osutil.Exists(input[i]) {
-			errorList = multierror.Append(errors.Wrapf(err, "input path exists: %s", input[i]))
+			diags.Addf(pjerrors.Diagnostic{File: input[i]}, "input path does not exist")
 			continue
 		}
 
 		// Process job configuration.
 		if err = filepath.Walk(input[i], func(inPath string, info os.FileInfo, err error) error {
 
-			if !osutil.HasExtension(inPath, prow.YamlExt) {
+			// A file named as input is read whatever its extension, such as /dev/stdin.
+			if (inPath != input[i] && !osutil.HasExtension(inPath, prow.YamlExt)) || osutil.IsDirectory(inPath) {
 				return nil
 			}
+			logger.WithField("file", inPath).Debug("Found input file.")
 
 			f, err := ioutil.ReadFile(inPath)
 			if err != nil {
-				errorList = multierror.Append(errors.Wrapf(err, "reading input path: %s", inPath))
+				diags.Add(pjerrors.Diagnostic{File: inPath}, errors.Wrapf(err, "reading input path"))
 				return nil
 			}
 
 			var jc cli.JobConfiguration
 			if err := yaml.Unmarshal(f, &jc); err != nil {
-				errorList = multierror.Append(errors.Wrapf(err, "unmarshal input config: %s", inPath))
+				diags.Add(pjerrors.Diagnostic{File: inPath, Line: source.ErrorLine(err)}, errors.Wrapf(err, "unmarshal input config"))
 				return nil
 			}
 
-			for i := range jc.Jobs {
-				job := &jc.Jobs[i]
+			src := source.Parse(inPath, f)
+			diags = append(diags, checkFields(src, strict)...)
 
-				for _, m := range []interface{}{cli.Job(jc.Defaults), globalConfig} {
-					if err := mergo.Merge(job, m); err != nil {
-						errorList = multierror.Append(errors.Wrapf(err, "merge input config: %s", inPath))
-						return nil
-					}
-				}
+			for i, job := range jc.Jobs {
+				line, column := src.Position("jobs", i)
+				jobs = append(jobs, inputJob{Job: job, Defaults: cli.Job(jc.Defaults), Source: inPath, Index: i, Line: line, Column: column})
+			}
+			return nil
+		}); err != nil {
+			diags.Add(pjerrors.Diagnostic{File: input[i]}, errors.Wrapf(err, "walking input path"))
+		}
+	}
 
-				for _, req := range job.Require {
-					if err := mergo.Merge(job, job.Requirements[req]); err != nil {
-						errorList = multierror.Append(errors.Wrapf(err, "merge requirement: %s", req))
-						return nil
-					}
-				}
+	return jobs, diags
+}
 
-				var outPath = output
-
-				if osutil.IsDirectory(output) {
-					if job.OutputTemplate != "" {
-						tmpl := prow.ResolveTemplate(job.OutputTemplate, job)
-						outPath = filepath.Join(output, tmpl)
-						if !osutil.HasExtension(outPath, prow.YamlExt) {
-							outPath += ".yaml"
-						}
-					} else {
-						outPath = filepath.Join(output, prow.DefaultOutput)
-					}
-				}
+// resolveJobs reads the global and input configuration files and resolves every job they define.
+func resolveJobs(opts resolveOptions) ([]resolvedJob, pjerrors.Diagnostics) {
+	r, diags := resolve(opts)
+	return r.Jobs, diags
+}
 
-				if _, exists := prowjobs[outPath]; !exists {
-					prowjobs[outPath] = prow.NewProwJobConfig()
-				}
+// resolution holds the resolved jobs along with the input jobs they were resolved from.
+type resolution struct {
+	Jobs []resolvedJob
+	// Inputs are the jobs as they are written in the input files, and Extended the same jobs after inheritance.
+	Inputs   []inputJob
+	Extended []inputJob
+}
+
+// resolve reads the global and input configuration files once and resolves every job they define.
+func resolve(opts resolveOptions) (resolution, pjerrors.Diagnostics) {
+	var r resolution
+	var output = opts.Output
+	var err error
+
+	// Process output directory.
+	if output, err = filepath.Abs(output); err != nil {
+		return r, pjerrors.Diagnostics{{Severity: pjerrors.Error, File: output, Message: errors.Wrapf(err, "getting output path").Error()}}
+	}
+
+	// Process global configuration files.
+	globalConfig, diags := loadProfileGlobal(opts)
+
+	// Process input configuration files.
+	var idiags pjerrors.Diagnostics
+	r.Inputs, idiags = readJobs(opts.Input, opts.Strict)
+	diags = append(diags, idiags...)
+
+	// Process job inheritance on a copy, since extending a job merges into its maps.
+	inputJobs := make([]inputJob, len(r.Inputs))
+	for i, ij := range r.Inputs {
+		inputJobs[i] = ij
+		if inputJobs[i].Job, err = ij.Job.DeepCopy(); err != nil {
+			diags.Add(ij.diagnostic(), errors.Wrapf(err, "copy job: %s", ij.Job.Name))
+		}
+	}
+
+	inputJobs, idiags = extendJobs(inputJobs)
+	diags = append(diags, idiags...)
+	r.Extended = inputJobs
+
+	// Process defaults, global configuration, requirements, branch overrides, matrices and templates.
+	for i := range inputJobs {
+		extends := inputJobs[i].Job.Extends
+
+		branchJobs, err := prow.ResolveBranches(inputJobs[i].log(), inputJobs[i].Job, inputJobs[i].Defaults, globalConfig)
+		if err != nil {
+			diags.Add(inputJobs[i].diagnostic(), err)
+			continue
+		}
+
+		var expanded []cli.Job
+		for _, branchJob := range branchJobs {
+			generated, err := prow.ExpandJob(branchJob)
+			if err != nil {
+				diags.Add(inputJobs[i].diagnostic(), err)
+				continue
+			}
+			expanded = append(expanded, generated...)
+		}
+
+		for k := range expanded {
+			job := &expanded[k]
+
+			resolved := resolvedJob{
+				Job:          job,
+				Source:       inputJobs[i].Source,
+				Line:         inputJobs[i].Line,
+				Column:       inputJobs[i].Column,
+				Output:       outputPath(output, job.OutputTemplate, prow.DefaultOutput),
+				Presets:      outputPath(output, "", prow.DefaultPresets),
+				ProwConfig:   outputPath(output, job.ProwConfigTemplate, ""),
+				PluginConfig: outputPath(output, job.PluginConfigTemplate, ""),
+			}
+			inputJobs[i].log().WithFields(logrus.Fields{"name": job.Name, "output": resolved.Output}).Debug("Choosing output path.")
 
-				prow.SetDefaults(job)
-
-				for _, jobType := range job.Types {
-					switch jobType {
-					case cli.Postsubmit:
-						prowjobs[outPath].AddPostsubmit(job.OrgRepo, job)
-					case cli.Periodic:
-						prowjobs[outPath].AddPeriodic(job)
-					case cli.Presubmit:
-						prowjobs[outPath].AddPresubmit(job.OrgRepo, job)
-					}
+			if opts.Verbose && extends != "" {
+				if err := reportJob(inputJobs[i].log(), resolved, extends); err != nil {
+					diags.Add(resolved.diagnostic(), err)
 				}
 			}
-			return nil
-		}); err != nil {
-			errorList = multierror.Append(errors.Wrapf(err, "walking input path: %s", input[i]))
+
+			r.Jobs = append(r.Jobs, resolved)
 		}
 	}
 
-	for path, jobs := range prowjobs {
-		if jobs.Empty() {
+	// Process duplicates, which may be generated from jobs with distinct names.
+	r.Jobs, idiags = removeDuplicates(r.Jobs)
+	diags = append(diags, idiags...)
+
+	return r, diags
+}
+
+// removeDuplicates reports and removes the jobs of the same type and name as an earlier job that run against the same
+// repository and branch, including the jobs generated by a matrix or branch overrides.
+func removeDuplicates(jobs []resolvedJob) ([]resolvedJob, pjerrors.Diagnostics) {
+	type jobKey struct {
+		Type cli.JobType
+		Repo string
+		Name string
+	}
+
+	var diags pjerrors.Diagnostics
+	var unique []resolvedJob
+	var seen = make(map[jobKey][]resolvedJob)
+
+	for _, job := range jobs {
+		var keys []jobKey
+		var duplicate bool
+
+		for _, jobType := range job.Types {
+			key := jobKey{Type: jobType, Name: job.Name}
+			if jobType != cli.Periodic {
+				key.Repo = job.OrgRepo
+			}
+
+			for _, other := range seen[key] {
+				if jobType == cli.Periodic || sets.NewString(other.Branches...).HasAny(job.Branches...) {
+					diags.Addf(job.diagnostic(), "duplicated %s job also defined in %s:%d", jobType, other.Source, other.Line)
+					duplicate = true
+					break
+				}
+			}
+
+			keys = append(keys, key)
+		}
+
+		if duplicate {
 			continue
 		}
 
-		jobConfig := prowapi.JobConfig{}
+		for _, key := range keys {
+			seen[key] = append(seen[key], job)
+		}
+		unique = append(unique, job)
+	}
+
+	return unique, diags
+}
+
+// outputPath returns the path within the output directory given by a job's output template, or by the default if the
+// template is empty. Without either, the job has no such output. An output which is not a directory is used as is.
+func outputPath(output, tmpl, def string) string {
+	if tmpl == "" && def == "" {
+		return ""
+	} else if !osutil.IsDirectory(output) {
+		return output
+	} else if tmpl == "" {
+		return filepath.Join(output, def)
+	}
+
+	path := filepath.Join(output, tmpl)
+	if !osutil.HasExtension(path, prow.YamlExt) {
+		path += ".yaml"
+	}
+	return path
+}
+
+// reportJob logs a fully resolved job which extends another job. Requirements are omitted since they have already
+// been merged into the job. With the text log format the job is written as YAML, to be read rather than parsed.
+func reportJob(log *logrus.Entry, job resolvedJob, extends string) error {
+	m, err := toMap(*job.Job)
+	if err != nil {
+		return errors.Wrapf(err, "convert resolved job")
+	}
+	delete(m, "requirements")
+
+	if _, ok := log.Logger.Formatter.(*logrus.JSONFormatter); ok {
+		log.WithFields(logrus.Fields{"extends": extends, "resolved": m}).Debug("Resolved extended job.")
+		return nil
+	}
+
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return errors.Wrapf(err, "marshal resolved job")
+	}
+
+	_, err = fmt.Fprintf(log.Logger.Out, "# %s:%d: job %s extends %s\n%s", job.Source, job.Line, job.Name, extends, b)
+	return err
+}
+
+// checkRepoConfigOutput reports jobs generating repository configuration when the output is a single file rather than
+// a directory, since the configuration of their repository would be written into the file of the jobs.
+func checkRepoConfigOutput(jobs []resolvedJob, output string) pjerrors.Diagnostics {
+	var diags pjerrors.Diagnostics
+
+	if osutil.IsDirectory(output) {
+		return diags
+	}
+
+	for _, job := range jobs {
+		if job.ProwConfigTemplate != "" || job.PluginConfigTemplate != "" {
+			diags.Addf(job.diagnostic(), "prow_config_tmpl and plugin_config_tmpl require the output to be a directory: %s", output)
+		}
+	}
+
+	return diags
+}
 
-		jobs.SortPeriodic(prow.SortOrder(sort))
-		jobs.SortPresubmit(prow.SortOrder(sort))
-		jobs.SortPostsubmit(prow.SortOrder(sort))
+// buildJobs converts resolved jobs into Prow jobs grouped by output path, along with the presets they apply and the
+// configuration of their repositories.
+func buildJobs(jobs []resolvedJob) (map[string]*prow.ProwJobConfig, pjerrors.Diagnostics) {
+	var prowjobs = make(map[string]*prow.ProwJobConfig)
+	var diags pjerrors.Diagnostics
 
-		if err = jobConfig.SetPresubmits(jobs.Presubmits); err != nil {
-			errorList = multierror.Append(errors.Wrapf(err, "settings presubmits: %s", path))
+	config := func(path string) *prow.ProwJobConfig {
+		if _, exists := prowjobs[path]; !exists {
+			prowjobs[path] = prow.NewProwJobConfig()
 		}
+		return prowjobs[path]
+	}
 
-		if err = jobConfig.SetPostsubmits(jobs.Postsubmits); err != nil {
-			errorList = multierror.Append(errors.Wrapf(err, "settings postsubmits: %s", path))
+	for _, job := range jobs {
+		config(job.Output).AddJob(job.Job)
+		diags.Add(job.diagnostic(), config(job.Presets).AddPresets(prow.CreatePresets(job.Job)))
+
+		if job.ProwConfig != "" {
+			diags.Add(job.diagnostic(), config(job.ProwConfig).AddRepoConfig(job.Job))
 		}
 
-		jobConfig.Periodics = jobs.Periodics
+		if job.PluginConfig != "" {
+			diags.Add(job.diagnostic(), config(job.PluginConfig).AddPlugins(job.Job))
+		}
+	}
 
-		jobConfigYaml, err := yaml.Marshal(jobConfig)
-		if err != nil {
-			errorList = multierror.Append(errors.Wrapf(err, "marshal job config: %s", path))
+	return prowjobs, diags
+}
+
+// marshalJobs marshals the Prow jobs for each output path into the bytes written to that path.
+func marshalJobs(prowjobs map[string]*prow.ProwJobConfig, sort prow.SortOrder) (map[string][]byte, pjerrors.Diagnostics) {
+	var out = make(map[string][]byte)
+	var diags pjerrors.Diagnostics
+
+	for _, path := range prow.SortedKeys(prowjobs) {
+		jobs := prowjobs[path]
+		if jobs.Empty() {
 			continue
 		}
 
-		dir := filepath.Dir(path)
-		if err = os.MkdirAll(dir, os.ModePerm); err != nil {
-			errorList = multierror.Append(errors.Wrapf(err, "creating directory: %s", path))
+		jobs.Sort(sort)
+
+		if _, err := jobs.JobConfig(); err != nil {
+			diags.Add(pjerrors.Diagnostic{File: path}, err)
+		}
+
+		jobConfigYaml, err := yaml.Marshal(jobs.OutputConfig())
+		if err != nil {
+			diags.Add(pjerrors.Diagnostic{File: path}, errors.Wrapf(err, "marshal job config"))
 			continue
 		}
 
 		outBytes := []byte(prow.AutogenHeader)
 		outBytes = append(outBytes, jobConfigYaml...)
 
-		if err = ioutil.WriteFile(path, outBytes, 0644); err != nil {
-			errorList = multierror.Append(errors.Wrapf(err, "writing job config: %s", path))
+		out[path] = outBytes
+	}
+
+	return out, diags
+}
+
+// writeJobs writes the Prow jobs to their output paths.
+func writeJobs(prowjobs map[string]*prow.ProwJobConfig, sort prow.SortOrder) pjerrors.Diagnostics {
+	out, diags := marshalJobs(prowjobs, sort)
+
+	for _, path := range prow.SortedKeys(out) {
+		dir := filepath.Dir(path)
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			diags.Add(pjerrors.Diagnostic{File: path}, errors.Wrapf(err, "creating directory"))
+			continue
+		}
+
+		if err := ioutil.WriteFile(path, out[path], 0644); err != nil {
+			diags.Add(pjerrors.Diagnostic{File: path}, errors.Wrapf(err, "writing job config"))
+			continue
 		}
+		logger.WithField("file", path).Debug("Wrote file.")
 	}
 
-	return errorList
+	return diags
 }
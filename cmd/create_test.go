@@ -0,0 +1,94 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+func TestRemoveDuplicates(t *testing.T) {
+	job := func(name string, jobType cli.JobType, repo string, line int, branches ...string) resolvedJob {
+		var j cli.Job
+		j.Name = name
+		j.OrgRepo = repo
+		j.Types = []cli.JobType{jobType}
+		j.Branches = branches
+		return resolvedJob{Job: &j, Source: "jobs.yaml", Line: line}
+	}
+
+	tests := []struct {
+		name   string
+		jobs   []resolvedJob
+		unique []int
+		errors int
+	}{
+		{
+			name:   "same name on the same branch",
+			jobs:   []resolvedJob{job("unit", cli.Presubmit, "org/repo", 1, "master"), job("unit", cli.Presubmit, "org/repo", 2, "master")},
+			unique: []int{1},
+			errors: 1,
+		},
+		{
+			name:   "same name on other branches",
+			jobs:   []resolvedJob{job("unit", cli.Presubmit, "org/repo", 1, "master"), job("unit", cli.Presubmit, "org/repo", 2, "release-1.8")},
+			unique: []int{1, 2},
+		},
+		{
+			name:   "same name in other repositories",
+			jobs:   []resolvedJob{job("unit", cli.Presubmit, "org/repo", 1, "master"), job("unit", cli.Presubmit, "org/other", 2, "master")},
+			unique: []int{1, 2},
+		},
+		{
+			name:   "same name of another type",
+			jobs:   []resolvedJob{job("unit", cli.Presubmit, "org/repo", 1, "master"), job("unit", cli.Postsubmit, "org/repo", 2, "master")},
+			unique: []int{1, 2},
+		},
+		{
+			name:   "periodics in other repositories",
+			jobs:   []resolvedJob{job("nightly", cli.Periodic, "org/repo", 1), job("nightly", cli.Periodic, "org/other", 2)},
+			unique: []int{1},
+			errors: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			unique, diags := removeDuplicates(tc.jobs)
+
+			var lines []int
+			for _, job := range unique {
+				lines = append(lines, job.Line)
+			}
+
+			if !reflect.DeepEqual(lines, tc.unique) {
+				t.Errorf("expected jobs %v, got %v", tc.unique, lines)
+			}
+			if len(diags) != tc.errors || (tc.errors > 0 && !diags.HasErrors()) {
+				t.Errorf("expected %d errors, got %v", tc.errors, diags)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	osutil "github.com/clarketm/pj/pkg/os"
+	"github.com/clarketm/pj/pkg/prow"
+)
+
+var diffShort = "Diff generated ProwJob yaml configuration against existing files"
+
+var diffLong = `Diff generated ProwJob yaml configuration against existing files
+
+Jobs are generated in memory from the same options as create and compared to the files under the output
+directory. Added, removed and changed jobs, presets and repository configuration are reported along with the
+fields that changed. The command exits with a non-zero status when the existing files are out of date.
+
+# Diff ProwJobs using short options.
+pj diff -g ./examples/global1.yaml -i ./examples/jobs.yaml -o ./jobs
+
+# Diff ProwJobs using long options.
+pj diff --global ./examples/global1.yaml --input ./examples/jobs.yaml --output ./jobs
+`
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: diffShort,
+	Long:  diffLong,
+	RunE:  diff,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	addResolveFlags(diffCmd, ".")
+	markSharedConfig(diffCmd)
+	addProfilesFlag(diffCmd)
+	diffCmd.Flags().StringP("sort", "s", "asc", "Sort jobs (asc|desc|source).")
+}
+
+func diff(cmd *cobra.Command, args []string) error {
+	return runProfiles(cmd, diffProfile)
+}
+
+// diffProfile runs the diff command for the active profile.
+func diffProfile(cmd *cobra.Command) error {
+	opts, err := getResolveOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	sortFlag, err := cmd.Flags().GetString("sort")
+	if err != nil {
+		return errors.Wrapf(err, "getting sort flag")
+	}
+
+	sortOrder, err := prow.ParseSortOrder(sortFlag)
+	if err != nil {
+		return errors.Wrapf(err, "parsing sort flag")
+	}
+
+	if opts.Output, err = filepath.Abs(opts.Output); err != nil {
+		return errors.Wrapf(err, "getting output path: %s", opts.Output)
+	}
+
+	jobs, diags := resolveJobs(opts)
+	diags = append(diags, checkRepoConfigOutput(jobs, opts.Output)...)
+	prowjobs, bdiags := buildJobs(jobs)
+	diags = append(diags, bdiags...)
+
+	generated, mdiags := marshalJobs(prowjobs, sortOrder)
+	if diags = append(diags, mdiags...); diags.HasErrors() {
+		return diags
+	}
+
+	existing, err := readGeneratedJobs(opts.Output, generated)
+	if err != nil {
+		return err
+	}
+
+	drift, err := printDiff(cmd.OutOrStdout(), opts.Output, existing, generated)
+	if err != nil {
+		return err
+	}
+
+	if drift > 0 {
+		return fmt.Errorf("%d job file(s) out of date", drift)
+	}
+
+	return nil
+}
+
+// readGeneratedJobs reads the existing files for every generated path, along with any other files under the
+// output directory previously generated by pj.
+func readGeneratedJobs(output string, generated map[string][]byte) (map[string][]byte, error) {
+	var existing = make(map[string][]byte)
+
+	for path := range generated {
+		if !osutil.IsFile(path) {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading output path: %s", path)
+		}
+
+		existing[path] = b
+	}
+
+	if !osutil.IsDirectory(output) {
+		return existing, nil
+	}
+
+	if err := filepath.Walk(output, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || !osutil.HasExtension(path, prow.YamlExt) {
+			return nil
+		}
+
+		if _, exists := existing[path]; exists {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "reading output path: %s", path)
+		}
+
+		if bytes.HasPrefix(b, []byte(prow.AutogenHeader)) {
+			existing[path] = b
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "walking output path: %s", output)
+	}
+
+	return existing, nil
+}
+
+// printDiff prints the semantic difference of each output file and returns the number of files that differ.
+func printDiff(w io.Writer, output string, existing, generated map[string][]byte) (int, error) {
+	var drift int
+
+	paths := make(map[string]struct{})
+	for path := range existing {
+		paths[path] = struct{}{}
+	}
+	for path := range generated {
+		paths[path] = struct{}{}
+	}
+
+	var sorted []string
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	for _, path := range sorted {
+		if bytes.Equal(existing[path], generated[path]) {
+			continue
+		}
+
+		diffs, err := prow.DiffJobConfigs(existing[path], generated[path])
+		if err != nil {
+			return drift, errors.Wrapf(err, "diffing job config: %s", path)
+		}
+
+		drift++
+
+		name := path
+		if rel, err := filepath.Rel(output, path); err == nil && osutil.IsDirectory(output) {
+			name = rel
+		}
+
+		switch {
+		case existing[path] == nil:
+			_, _ = fmt.Fprintf(w, "%s %s (new file)\n", prow.Added, name)
+		case generated[path] == nil:
+			_, _ = fmt.Fprintf(w, "%s %s (removed file)\n", prow.Removed, name)
+		default:
+			_, _ = fmt.Fprintf(w, "%s %s\n", prow.Changed, name)
+		}
+
+		if len(diffs) == 0 {
+			_, _ = fmt.Fprintln(w, "    (formatting or ordering differs)")
+		}
+
+		for _, d := range diffs {
+			_, _ = fmt.Fprintf(w, "    %s\n", d)
+			for _, f := range d.Fields {
+				_, _ = fmt.Fprintf(w, "        %s\n", f)
+			}
+		}
+	}
+
+	return drift, nil
+}
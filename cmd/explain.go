@@ -0,0 +1,285 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/clarketm/pj/pkg/prow"
+	strutil "github.com/clarketm/pj/pkg/strings"
+)
+
+var explainShort = "Explain where every field of a resolved job comes from"
+
+var explainLong = `Explain where every field of a resolved job comes from
+
+The job is resolved like create does and printed with each field annotated by its origin: a branch override, the
+job itself, a job it extends, the file-level defaults, the defaults of the profile, a global configuration file or
+a requirement. Values of lower precedence which the field shadows are listed after it. Lists combined from several
+of them, such as env and volumes, are annotated item by item. Fields set by none of them have a default or
+generated value.
+
+# Explain the unit job of istio/istio.
+pj explain -g ./examples/global1.yaml,./examples/requirements.yaml -i ./examples/jobs.yaml istio/istio/unit
+`
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain <repo>/<job>",
+	Short: explainShort,
+	Long:  explainLong,
+	Args:  cobra.ExactArgs(1),
+	RunE:  explain,
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+	addResolveFlags(explainCmd, "")
+	markSharedConfig(explainCmd)
+}
+
+func explain(cmd *cobra.Command, args []string) error {
+	opts, err := getResolveOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	var orgRepo, name = "", args[0]
+	if n := strings.LastIndex(name, "/"); n >= 0 {
+		orgRepo, name = name[:n], name[n+1:]
+	}
+
+	r, diags := resolve(opts)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	var matches []resolvedJob
+	var names []string
+
+	for _, job := range r.Jobs {
+		if job.Name == name && (orgRepo == "" || job.OrgRepo == orgRepo) {
+			matches = append(matches, job)
+		}
+		names = append(names, fmt.Sprintf("%s/%s", job.OrgRepo, job.Name))
+	}
+
+	if len(matches) == 0 {
+		msg := fmt.Sprintf("job not found: %s", args[0])
+		if closest := strutil.Closest(args[0], names); closest != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", closest)
+		}
+		return errors.New(msg)
+	}
+
+	for i, job := range matches {
+		layers, err := jobLayers(job, r.Inputs, r.Extended, opts)
+		if err != nil {
+			return errors.Wrapf(err, "job %s", job.Name)
+		}
+
+		origins, err := prow.Explain(*job.Job, layers)
+		if err != nil {
+			return errors.Wrapf(err, "job %s", job.Name)
+		}
+
+		if i > 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "---")
+		}
+
+		if err := printExplained(cmd.OutOrStdout(), job, origins); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jobLayers returns the configurations a resolved job was merged from, in order of precedence.
+func jobLayers(job resolvedJob, rawJobs, extended []inputJob, opts resolveOptions) ([]prow.Layer, error) {
+	var layers []prow.Layer
+
+	i := sourceIndex(rawJobs, job.Source, job.Line)
+	if i < 0 {
+		return nil, fmt.Errorf("job not found in %s:%d", job.Source, job.Line)
+	}
+	raw := rawJobs[i]
+
+	if e := sourceIndex(extended, job.Source, job.Line); e >= 0 && len(job.Branches) == 1 {
+		overrides := extended[e].Job.BranchOverrides
+		key, err := prow.BranchOverride(overrides, job.Branches[0])
+		if err != nil {
+			return nil, err
+		}
+		if key != "" {
+			layers = append(layers, prow.Layer{Origin: fmt.Sprintf("branch_overrides[%s] (%s)", key, location(raw)), Job: overrides[key]})
+		}
+	}
+
+	layers = append(layers, prow.Layer{Origin: fmt.Sprintf("job (%s)", location(raw)), Job: raw.Job})
+
+	// Follow the jobs it extends, each of which is only used for the fields the jobs extending it do not set.
+	for k, n := i, 0; rawJobs[k].Job.Extends != "" && n < len(rawJobs); n++ {
+		p, err := findJob(rawJobs, k)
+		if err != nil {
+			return nil, err
+		}
+
+		parent := rawJobs[p].Job
+		parent.Name = ""
+		layers = append(layers, prow.Layer{Origin: fmt.Sprintf("extends %s (%s)", rawJobs[p].Job.Name, location(rawJobs[p])), Job: parent})
+		k = p
+	}
+
+	layers = append(layers, prow.Layer{Origin: fmt.Sprintf("defaults (%s)", raw.Source), Job: raw.Defaults, Inherited: true})
+
+	if opts.Profile != "" {
+		profile, err := profileDefaults(opts.Profile)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, prow.Layer{Origin: fmt.Sprintf("profile %s (%s)", opts.Profile, viper.ConfigFileUsed()), Job: profile, Inherited: true})
+	}
+
+	for _, g := range opts.Global {
+		global, diags := loadGlobal([]string{g}, false)
+		if diags.HasErrors() {
+			return nil, diags.Err()
+		}
+		layers = append(layers, prow.Layer{Origin: fmt.Sprintf("global (%s)", g), Job: global, Inherited: true})
+	}
+
+	requirements, err := prow.RequirementLayers(*job.Job)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(layers, requirements...), nil
+}
+
+// sourceIndex returns the index of the job defined at a position of an input file, or -1 if there is none.
+func sourceIndex(jobs []inputJob, source string, line int) int {
+	for i, job := range jobs {
+		if job.Source == source && job.Line == line {
+			return i
+		}
+	}
+	return -1
+}
+
+// location returns the position of a job in its input file.
+func location(job inputJob) string {
+	return fmt.Sprintf("%s:%d", job.Source, job.Line)
+}
+
+// printExplained writes a resolved job with each field annotated by its origin and the values it shadows.
+func printExplained(w io.Writer, job resolvedJob, origins []prow.FieldOrigin) error {
+	m, err := toMap(*job.Job)
+	if err != nil {
+		return errors.Wrapf(err, "convert resolved job")
+	}
+	delete(m, "requirements")
+
+	var doc yaml.Node
+	if err := doc.Encode(m); err != nil {
+		return errors.Wrapf(err, "encode resolved job")
+	}
+
+	var comments = make(map[string]string)
+	for _, o := range origins {
+		comments[strings.Join(o.Path, "\x00")] = originComment(o)
+	}
+	annotate(&doc, nil, comments)
+
+	doc.HeadComment = fmt.Sprintf("%s/%s (%s): %s:%d", job.OrgRepo, job.Name, job.Types[0], job.Source, job.Line)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return errors.Wrapf(err, "marshal resolved job")
+	}
+
+	return enc.Close()
+}
+
+// annotate sets the comment of every field of a mapping node which has one, recursing into the fields without. Items
+// of a list are annotated by index, on the line they start on.
+func annotate(node *yaml.Node, path []string, comments map[string]string) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			p := append(append([]string{}, path...), key.Value)
+
+			comment, exists := comments[strings.Join(p, "\x00")]
+			switch {
+			case !exists:
+			case value.Kind == yaml.ScalarNode || value.Style&yaml.FlowStyle != 0:
+				value.LineComment = comment
+				continue
+			default:
+				key.LineComment = comment
+			}
+			annotate(value, p, comments)
+		}
+
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			comment, exists := comments[strings.Join(append(append([]string{}, path...), strconv.Itoa(i)), "\x00")]
+			switch {
+			case !exists:
+			case item.Kind == yaml.MappingNode && len(item.Content) > 0 && item.Style&yaml.FlowStyle == 0:
+				item.Content[0].LineComment = comment
+			default:
+				item.LineComment = comment
+			}
+		}
+	}
+}
+
+// originComment describes the origin of a field and the values it shadows.
+func originComment(o prow.FieldOrigin) string {
+	comment := "default"
+	if len(o.Origins) > 0 {
+		comment = strings.Join(o.Origins, " + ")
+	}
+
+	for _, s := range o.Shadowed {
+		b, err := json.Marshal(s.Value)
+		if err != nil {
+			b = []byte(fmt.Sprint(s.Value))
+		}
+		comment += fmt.Sprintf("; shadows %s: %s", s.Origin, b)
+	}
+
+	return comment
+}
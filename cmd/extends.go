@@ -0,0 +1,182 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/clarketm/pj/pkg/cli"
+	pjerrors "github.com/clarketm/pj/pkg/errors"
+	"github.com/clarketm/pj/pkg/prow"
+	strutil "github.com/clarketm/pj/pkg/strings"
+)
+
+// inputJob is a job as written in an input file, along with the defaults of that file and its index in the jobs
+// of that file.
+type inputJob struct {
+	Job      cli.Job
+	Defaults cli.Job
+	Source   string
+	Index    int
+	Line     int
+	Column   int
+}
+
+// diagnostic returns a diagnostic template locating the job.
+func (j inputJob) diagnostic() pjerrors.Diagnostic {
+	return pjerrors.Diagnostic{File: j.Source, Line: j.Line, Column: j.Column, Job: j.Job.Name}
+}
+
+// log returns a logger locating the job.
+func (j inputJob) log() *logrus.Entry {
+	return logger.WithFields(logrus.Fields{"file": j.Source, "line": j.Line, "repo": j.orgRepo(), "job": j.Job.Name})
+}
+
+// orgRepo returns the repository of the job, falling back to the defaults of its file.
+func (j inputJob) orgRepo() string {
+	if j.Job.OrgRepo != "" {
+		return j.Job.OrgRepo
+	}
+	return j.Defaults.OrgRepo
+}
+
+// extendJobs merges into each job the jobs it extends, transitively. Jobs which cannot be extended are reported and
+// removed.
+func extendJobs(jobs []inputJob) ([]inputJob, pjerrors.Diagnostics) {
+	var diags pjerrors.Diagnostics
+
+	var extend func(i int, path []int) (cli.Job, error)
+	extend = func(i int, path []int) (cli.Job, error) {
+		for n, p := range path {
+			if p == i {
+				var names []string
+				for _, k := range append(path[n:], i) {
+					names = append(names, jobs[k].Job.Name)
+				}
+				return cli.Job{}, fmt.Errorf("extends cycle: %s", strings.Join(names, " -> "))
+			}
+		}
+
+		job := jobs[i].Job
+		if job.Extends == "" {
+			return job, nil
+		}
+
+		p, err := findJob(jobs, i)
+		if err != nil && len(path) > 0 {
+			return cli.Job{}, errors.Wrapf(err, "job %s", job.Name)
+		} else if err != nil {
+			return cli.Job{}, err
+		}
+
+		parent, err := extend(p, append(path, i))
+		if err != nil {
+			return cli.Job{}, err
+		}
+
+		jobs[i].log().WithFields(logrus.Fields{"layer": "extends", "extends": job.Extends}).Debug("Merging layer.")
+		if err := prow.ExtendJob(&job, parent); err != nil {
+			return cli.Job{}, err
+		}
+
+		return job, nil
+	}
+
+	var extended = make([]cli.Job, len(jobs))
+	var errs = make([]error, len(jobs))
+
+	// Extend every job before replacing any, so that parents are always extended from their definition.
+	for i := range jobs {
+		extended[i], errs[i] = extend(i, nil)
+	}
+
+	var out []inputJob
+
+	for i := range jobs {
+		if errs[i] != nil {
+			diags.Add(jobs[i].diagnostic(), errs[i])
+			continue
+		}
+
+		jobs[i].Job = extended[i]
+		out = append(out, jobs[i])
+	}
+
+	return out, diags
+}
+
+// findJob returns the index of the job extended by the i-th job, other than itself. A bare name matches jobs in the
+// same file first and then jobs in any input file; a name qualified as `<org>/<repo>/<name>` only matches jobs of
+// that repository.
+func findJob(jobs []inputJob, i int) (int, error) {
+	var name = jobs[i].Job.Extends
+	var orgRepo string
+
+	if n := strings.LastIndex(name, "/"); n >= 0 {
+		orgRepo, name = name[:n], name[n+1:]
+	}
+
+	var all, local []int
+	var names []string
+
+	for k, job := range jobs {
+		names = append(names, job.Job.Name)
+
+		// A job never extends itself, but may extend a job of the same name defined elsewhere.
+		if k == i || job.Job.Name != name || (orgRepo != "" && job.orgRepo() != orgRepo) {
+			continue
+		}
+
+		all = append(all, k)
+		if job.Source == jobs[i].Source {
+			local = append(local, k)
+		}
+	}
+
+	var candidates = all
+	if len(local) > 0 {
+		candidates = local
+	}
+
+	switch len(candidates) {
+	case 0:
+		msg := fmt.Sprintf("unknown job: %s", jobs[i].Job.Extends)
+		if closest := strutil.Closest(name, names); closest != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", closest)
+		}
+		return 0, errors.New(msg)
+	case 1:
+		return candidates[0], nil
+	}
+
+	var defined []string
+	for _, k := range candidates {
+		defined = append(defined, fmt.Sprintf("%s:%d", jobs[k].Source, jobs[k].Line))
+	}
+
+	return 0, fmt.Errorf("ambiguous job: %s is defined in %s (qualify it as <org>/<repo>/%s)", jobs[i].Job.Extends, strings.Join(defined, ", "), name)
+}
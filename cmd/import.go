@@ -0,0 +1,658 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	prowapi "k8s.io/test-infra/prow/config"
+	"sigs.k8s.io/yaml"
+
+	"github.com/clarketm/pj/pkg/cli"
+	pjerrors "github.com/clarketm/pj/pkg/errors"
+	pjlog "github.com/clarketm/pj/pkg/log"
+	osutil "github.com/clarketm/pj/pkg/os"
+	"github.com/clarketm/pj/pkg/prow"
+	"github.com/clarketm/pj/pkg/source"
+)
+
+var importShort = "Import ProwJob yaml configuration as pj job configuration"
+
+var importLong = `Import ProwJob yaml configuration as pj job configuration
+
+Each Prow job file is converted into an equivalent pj job configuration. Fields shared by every job are factored
+into the file-level defaults, fields provided by the global configuration are omitted, and labels, volumes and
+other fields matching a global requirement are replaced by a require entry. Jobs which cannot be reproduced
+exactly by create are reported on stderr.
+
+# Import ProwJobs using short options.
+pj import -g ./examples/requirements.yaml -i ./jobs/istio.istio.gen.yaml -o ./examples
+
+# Import ProwJobs using long options.
+pj import --global ./examples/requirements.yaml --input ./jobs --output ./examples
+`
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: importShort,
+	Long:  importLong,
+	RunE:  importJobs,
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringSliceP("global", "g", []string{}, "Global configuration files.")
+	importCmd.Flags().StringSliceP("input", "i", []string{"/dev/stdin"}, "Prow job files and/or directories.")
+	importCmd.Flags().StringP("output", "o", "/dev/stdout", "Output directory.")
+	markPathFlags(importCmd, "global", "input", "output")
+}
+
+// importedJob is a job converted from one or more Prow jobs sharing a name.
+type importedJob struct {
+	Job       cli.Job
+	Originals map[cli.JobType]interface{}
+}
+
+func importJobs(cmd *cobra.Command, args []string) error {
+	global, err := cmd.Flags().GetStringSlice("global")
+	if err != nil {
+		return errors.Wrapf(err, "getting global flag")
+	}
+
+	input, err := cmd.Flags().GetStringSlice("input")
+	if err != nil {
+		return errors.Wrapf(err, "getting input flag")
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return errors.Wrapf(err, "getting output flag")
+	}
+
+	if output, err = filepath.Abs(output); err != nil {
+		return errors.Wrapf(err, "getting output path: %s", output)
+	}
+
+	globalConfig, diags := loadGlobal(global, false)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	var inPaths []string
+	for _, in := range input {
+		if err := filepath.Walk(in, func(inPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if osutil.HasExtension(inPath, prow.YamlExt) {
+				logger.WithField("file", inPath).Debug("Found input file.")
+				inPaths = append(inPaths, inPath)
+			}
+			return nil
+		}); err != nil {
+			diags.Add(pjerrors.Diagnostic{File: in}, errors.Wrapf(err, "walking input path"))
+		}
+	}
+
+	if len(inPaths) > 1 && !osutil.IsDirectory(output) {
+		diags.Addf(pjerrors.Diagnostic{File: output}, "output must be a directory when importing multiple files")
+		return diags
+	}
+
+	var written = make(map[string]string)
+
+	for _, inPath := range inPaths {
+		jobConfig, err := prowapi.ReadJobConfig(inPath)
+		if err != nil {
+			diags.Add(pjerrors.Diagnostic{File: inPath, Line: source.ErrorLine(err)}, errors.Wrapf(err, "reading input path"))
+			continue
+		}
+
+		jc, warnings, err := importJobConfig(jobConfig, globalConfig)
+		if err != nil {
+			diags.Add(pjerrors.Diagnostic{File: inPath}, errors.Wrapf(err, "importing job config"))
+			continue
+		}
+
+		for _, w := range warnings {
+			w.File = inPath
+			diags = append(diags, w)
+		}
+
+		jcYaml, err := yaml.Marshal(jc)
+		if err != nil {
+			diags.Add(pjerrors.Diagnostic{File: inPath}, errors.Wrapf(err, "marshal job configuration"))
+			continue
+		}
+
+		outPath := output
+		if osutil.IsDirectory(output) {
+			name := strings.TrimSuffix(filepath.Base(inPath), filepath.Ext(inPath))
+			outPath = filepath.Join(output, strings.TrimSuffix(name, ".gen")+".yaml")
+		}
+
+		logger.WithFields(logrus.Fields{"file": inPath, "output": outPath}).Debug("Choosing output path.")
+
+		// Input files with the same name in different directories would be imported to the same file.
+		if other, exists := written[outPath]; exists {
+			diags.Addf(pjerrors.Diagnostic{File: inPath}, "output path %s is also the output path of %s", outPath, other)
+			continue
+		}
+		written[outPath] = inPath
+
+		if err := ioutil.WriteFile(outPath, jcYaml, 0644); err != nil {
+			diags.Add(pjerrors.Diagnostic{File: outPath}, errors.Wrapf(err, "writing job configuration"))
+			continue
+		}
+		logger.WithField("file", outPath).Debug("Wrote file.")
+	}
+
+	return diags.Err()
+}
+
+// importJobConfig converts a Prow job configuration into a job configuration. Every transformation is checked
+// by resolving the resulting jobs the same way create does; jobs that still differ from the original are
+// returned as warnings.
+func importJobConfig(jobConfig prowapi.JobConfig, global cli.Job) (map[string]interface{}, pjerrors.Diagnostics, error) {
+	jobs, err := importProwJobs(jobConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defaults := make(map[string]interface{})
+
+	globalMap, err := toMap(global)
+	if err != nil {
+		return nil, nil, err
+	}
+	delete(globalMap, "requirements")
+
+	requirements, err := sortedRequirements(global.Requirements)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	baseline := make([][]prow.FieldDiff, len(jobs))
+	for i := range jobs {
+		if baseline[i], err = roundTrip(jobs[i], defaults, global); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// accept replaces a job with a candidate if it resolves to the same Prow jobs.
+	accept := func(i int, candidate map[string]interface{}) error {
+		var ij = importedJob{Originals: jobs[i].Originals}
+
+		if err := prow.JobFromMap(candidate, &ij.Job); err != nil {
+			return err
+		}
+
+		diffs, err := roundTrip(ij, defaults, global)
+		if err != nil {
+			return err
+		}
+
+		if reflect.DeepEqual(diffs, baseline[i]) {
+			jobs[i] = ij
+		}
+		return nil
+	}
+
+	for i := range jobs {
+		// Omit fields provided by the global configuration.
+		m, err := toMap(jobs[i].Job)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := accept(i, subtract(m, globalMap)); err != nil {
+			return nil, nil, err
+		}
+
+		// Replace fields provided by a requirement.
+		for _, req := range requirements {
+			m, err := toMap(jobs[i].Job)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if !contains(m, req.fields) {
+				continue
+			}
+
+			m = subtract(m, req.fields)
+			m["require"] = append(toSlice(m["require"]), req.name)
+
+			if err := accept(i, m); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	// Factor fields shared by every job into the file-level defaults.
+	if len(jobs) > 1 {
+		var fields []map[string]interface{}
+		for _, ij := range jobs {
+			m, err := toMap(ij.Job)
+			if err != nil {
+				return nil, nil, err
+			}
+			fields = append(fields, m)
+		}
+
+		for _, k := range commonKeys(fields) {
+			defaults[k] = fields[0][k]
+
+			var candidates []importedJob
+			var ok = true
+
+			for i, m := range fields {
+				var ij = importedJob{Originals: jobs[i].Originals}
+
+				if err := prow.JobFromMap(without(m, k), &ij.Job); err != nil {
+					return nil, nil, err
+				}
+
+				diffs, err := roundTrip(ij, defaults, global)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				if !reflect.DeepEqual(diffs, baseline[i]) {
+					ok = false
+					break
+				}
+
+				candidates = append(candidates, ij)
+			}
+
+			if !ok {
+				delete(defaults, k)
+				continue
+			}
+
+			jobs = candidates
+			for _, m := range fields {
+				delete(m, k)
+			}
+		}
+	}
+
+	var warnings pjerrors.Diagnostics
+	var jobMaps []interface{}
+
+	for i, ij := range jobs {
+		m, err := toMap(ij.Job)
+		if err != nil {
+			return nil, nil, err
+		}
+		jobMaps = append(jobMaps, m)
+
+		for _, d := range baseline[i] {
+			warnings.Addf(pjerrors.Diagnostic{Severity: pjerrors.Warning, Job: ij.Job.Name}, "does not round-trip: %s", d)
+		}
+	}
+
+	out := defaults
+	out["jobs"] = jobMaps
+
+	return out, warnings, nil
+}
+
+// importProwJobs converts every Prow job into a job, combining a presubmit and postsubmit of the same name and
+// repository into a single job when possible. Template actions in the Prow jobs are escaped.
+func importProwJobs(jobConfig prowapi.JobConfig) ([]importedJob, error) {
+	var jobs []importedJob
+
+	for _, repo := range prow.SortedKeys(jobConfig.PresubmitsStatic) {
+		for _, ps := range jobConfig.PresubmitsStatic[repo] {
+			jobs = append(jobs, importedJob{
+				Job:       prow.ImportPresubmit(repo, ps),
+				Originals: map[cli.JobType]interface{}{cli.Presubmit: ps},
+			})
+		}
+	}
+
+	for _, repo := range prow.SortedKeys(jobConfig.PostsubmitsStatic) {
+	postsubmits:
+		for _, ps := range jobConfig.PostsubmitsStatic[repo] {
+			for i, ij := range jobs {
+				if ij.Job.OrgRepo != repo || ij.Job.Name != ps.Name || len(ij.Originals) > 1 || ij.Originals[cli.Presubmit] == nil {
+					continue
+				}
+
+				candidate := ij.Job
+				candidate.Type = ""
+				candidate.Types = []cli.JobType{cli.Presubmit, cli.Postsubmit}
+
+				if diffs, err := prow.DiffJobs(ps, prow.CreatePostsubmit(&candidate)); err == nil && len(diffs) == 0 {
+					jobs[i].Job = candidate
+					jobs[i].Originals[cli.Postsubmit] = ps
+					continue postsubmits
+				}
+			}
+
+			jobs = append(jobs, importedJob{
+				Job:       prow.ImportPostsubmit(repo, ps),
+				Originals: map[cli.JobType]interface{}{cli.Postsubmit: ps},
+			})
+		}
+	}
+
+	for _, p := range jobConfig.Periodics {
+		jobs = append(jobs, importedJob{
+			Job:       prow.ImportPeriodic(p),
+			Originals: map[cli.JobType]interface{}{cli.Periodic: p},
+		})
+	}
+
+	for i := range jobs {
+		job, err := prow.EscapeTemplates(jobs[i].Job)
+		if err != nil {
+			return nil, err
+		}
+		jobs[i].Job = job
+	}
+
+	return jobs, nil
+}
+
+// roundTrip resolves an imported job as create would and returns how it differs from the original Prow jobs.
+func roundTrip(ij importedJob, defaults map[string]interface{}, global cli.Job) ([]prow.FieldDiff, error) {
+	var job, d cli.Job
+
+	m, err := toMap(ij.Job)
+	if err != nil {
+		return nil, err
+	}
+	if err := prow.JobFromMap(m, &job); err != nil {
+		return nil, err
+	}
+	if err := prow.JobFromMap(defaults, &d); err != nil {
+		return nil, err
+	}
+
+	if err := prow.ResolveJob(pjlog.Discard(), &job, d, global); err != nil {
+		return nil, err
+	}
+	prow.SetDefaults(&job)
+
+	expanded, err := prow.ExpandJob(job)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []prow.FieldDiff
+
+	for _, jobType := range []cli.JobType{cli.Presubmit, cli.Postsubmit, cli.Periodic} {
+		var created interface{}
+
+		for i := range expanded {
+			if expanded[i].Types[0] != jobType {
+				continue
+			}
+
+			// A Prow job is imported as a single job, which must not generate several jobs of its type.
+			if created != nil {
+				return nil, fmt.Errorf("job %s generates more than one %s", ij.Job.Name, jobType)
+			}
+
+			switch jobType {
+			case cli.Presubmit:
+				created = prow.CreatePresubmit(&expanded[i])
+			case cli.Postsubmit:
+				created = prow.CreatePostsubmit(&expanded[i])
+			case cli.Periodic:
+				created = prow.CreatePeriodic(&expanded[i])
+			}
+		}
+
+		original := ij.Originals[jobType]
+		if original == nil && created == nil {
+			continue
+		}
+
+		fields, err := prow.DiffJobs(original, created)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fields {
+			f.Path = fmt.Sprintf("%s.%s", jobType, f.Path)
+			diffs = append(diffs, f)
+		}
+	}
+
+	return diffs, nil
+}
+
+type requirement struct {
+	name   string
+	fields map[string]interface{}
+}
+
+// sortedRequirements returns the requirements ordered by decreasing size, so that larger bundles are preferred
+// over the smaller bundles they contain.
+func sortedRequirements(requirements map[string]cli.Job) ([]requirement, error) {
+	var reqs []requirement
+
+	for name := range requirements {
+		// Compare against everything the requirement provides, including the requirements it requires itself.
+		var job = cli.Job{JobProw: cli.JobProw{Require: []string{name}, Requirements: requirements}}
+		if err := prow.ResolveJob(pjlog.Discard(), &job, cli.Job{}, cli.Job{}); err != nil {
+			return nil, err
+		}
+		job.Require = nil
+		job.Requirements = nil
+
+		m, err := toMap(job)
+		if err != nil {
+			return nil, err
+		}
+		if len(m) == 0 {
+			continue
+		}
+		reqs = append(reqs, requirement{name: name, fields: m})
+	}
+
+	sort.Slice(reqs, func(a, b int) bool {
+		sa, sb := size(reqs[a].fields), size(reqs[b].fields)
+		if sa != sb {
+			return sa > sb
+		}
+		return reqs[a].name < reqs[b].name
+	})
+
+	return reqs, nil
+}
+
+// toMap converts a job into its unmarshaled representation, omitting fields which do not affect decoding.
+func toMap(job cli.Job) (map[string]interface{}, error) {
+	m, err := prow.JobToMap(job)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range m {
+		delete(m, k)
+
+		var stripped cli.Job
+		if err := prow.JobFromMap(m, &stripped); err != nil || !reflect.DeepEqual(stripped, job) {
+			m[k] = v
+		}
+	}
+
+	return m, nil
+}
+
+// contains reports whether every field of sub is present in v. Lists contain sub if they include every item.
+func contains(v, sub interface{}) bool {
+	switch s := sub.(type) {
+	case map[string]interface{}:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, e := range s {
+			if !contains(m[k], e) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, ok := v.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, e := range s {
+			if indexOf(l, e) < 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(v, sub)
+}
+
+// subtract returns a copy of m without the fields of sub, removing matching map entries and list items.
+func subtract(m, sub map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+
+	for k, v := range m {
+		s, exists := sub[k]
+		if !exists {
+			out[k] = v
+			continue
+		}
+
+		switch t := v.(type) {
+		case map[string]interface{}:
+			if sm, ok := s.(map[string]interface{}); ok {
+				if r := subtract(t, sm); len(r) > 0 {
+					out[k] = r
+				}
+				continue
+			}
+		case []interface{}:
+			if sl, ok := s.([]interface{}); ok {
+				var r []interface{}
+				for _, e := range t {
+					if indexOf(sl, e) < 0 {
+						r = append(r, e)
+					}
+				}
+				if len(r) > 0 {
+					out[k] = r
+				}
+				continue
+			}
+		}
+
+		if !reflect.DeepEqual(v, s) {
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+// commonKeys returns the keys, other than the job name, whose values are equal in every map.
+func commonKeys(fields []map[string]interface{}) []string {
+	var keys []string
+
+	for k, v := range fields[0] {
+		if k == "name" {
+			continue
+		}
+
+		common := true
+		for _, m := range fields[1:] {
+			if e, exists := m[k]; !exists || !reflect.DeepEqual(e, v) {
+				common = false
+				break
+			}
+		}
+
+		if common {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// without returns a copy of m without the key k.
+func without(m map[string]interface{}, k string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for key, v := range m {
+		if key != k {
+			out[key] = v
+		}
+	}
+	return out
+}
+
+func indexOf(l []interface{}, v interface{}) int {
+	for i, e := range l {
+		if reflect.DeepEqual(e, v) {
+			return i
+		}
+	}
+	return -1
+}
+
+func toSlice(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+// size returns the number of leaf values in an unmarshaled value.
+func size(v interface{}) int {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		var n int
+		for _, e := range t {
+			n += size(e)
+		}
+		return n
+	case []interface{}:
+		var n int
+		for _, e := range t {
+			n += size(e)
+		}
+		return n
+	}
+	return 1
+}
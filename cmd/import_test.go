@@ -0,0 +1,232 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	prowapi "k8s.io/test-infra/prow/config"
+	"sigs.k8s.io/yaml"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+func TestImportJobConfig(t *testing.T) {
+	presubmits := `
+presubmits:
+  org/repo:
+  - name: unit
+    always_run: true
+    decorate: true
+    labels: {preset-gcp: "true"}
+    branches: [master]
+    trigger: "(?m)^/test( | .* )unit,?($|\\s.*)"
+    rerun_command: /test unit
+    spec: {containers: [{image: golang, command: [make, test]}]}
+  - name: lint
+    always_run: true
+    decorate: true
+    branches: [master]
+    trigger: "(?m)^/test( | .* )lint,?($|\\s.*)"
+    rerun_command: /test lint
+    spec: {containers: [{image: golang, command: [make, lint]}]}
+`
+
+	tests := []struct {
+		name     string
+		config   string
+		global   string
+		expected string
+		warnings int
+	}{
+		{
+			name:   "shared fields become defaults",
+			config: presubmits,
+			global: `{}`,
+			expected: `
+branches: [master]
+image: golang
+repo: org/repo
+skip_submodules: false
+type: presubmit
+jobs:
+- {name: unit, command: [make, test], labels: {preset-gcp: "true"}}
+- {name: lint, command: [make, lint]}
+`,
+		},
+		{
+			name:   "fields of a requirement are required",
+			config: presubmits,
+			global: `{requirements: {gcp: {labels: {preset-gcp: "true"}}}}`,
+			expected: `
+branches: [master]
+image: golang
+repo: org/repo
+skip_submodules: false
+type: presubmit
+jobs:
+- {name: unit, command: [make, test], require: [gcp]}
+- {name: lint, command: [make, lint]}
+`,
+		},
+		{
+			name:   "fields of the global configuration are omitted",
+			config: presubmits,
+			global: `{image: golang, branches: [master]}`,
+			expected: `
+repo: org/repo
+skip_submodules: false
+type: presubmit
+jobs:
+- {name: unit, command: [make, test], labels: {preset-gcp: "true"}}
+- {name: lint, command: [make, lint]}
+`,
+		},
+		{
+			name: "jobs which do not round-trip are reported",
+			config: `
+presubmits:
+  org/repo:
+  - name: unit
+    always_run: true
+    decorate: true
+    spec: {containers: [{image: golang}]}
+`,
+			global: `{}`,
+			expected: `
+jobs:
+- {name: unit, repo: org/repo, type: presubmit, image: golang, skip_submodules: false}
+`,
+			warnings: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var jobConfig prowapi.JobConfig
+			if err := yaml.Unmarshal([]byte(tc.config), &jobConfig); err != nil {
+				t.Fatalf("unmarshal job config: %v", err)
+			}
+
+			var global cli.Job
+			if err := yaml.Unmarshal([]byte(tc.global), &global); err != nil {
+				t.Fatalf("unmarshal global config: %v", err)
+			}
+
+			out, warnings, err := importJobConfig(jobConfig, global)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var expected map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tc.expected), &expected); err != nil {
+				t.Fatalf("unmarshal expected config: %v", err)
+			}
+
+			actual, err := yaml.Marshal(out)
+			if err != nil {
+				t.Fatalf("marshal config: %v", err)
+			}
+			if want, _ := yaml.Marshal(expected); string(actual) != string(want) {
+				t.Errorf("expected:\n%s\ngot:\n%s", want, actual)
+			}
+
+			if len(warnings) != tc.warnings {
+				t.Errorf("expected %d warnings, got %v", tc.warnings, warnings)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		name     string
+		v        string
+		sub      string
+		expected bool
+	}{
+		{name: "subset of a map", v: `{a: 1, b: {c: 2, d: 3}}`, sub: `{b: {c: 2}}`, expected: true},
+		{name: "other value", v: `{a: 1}`, sub: `{a: 2}`, expected: false},
+		{name: "missing key", v: `{a: 1}`, sub: `{b: 1}`, expected: false},
+		{name: "items of a list", v: `{a: [1, 2, 3]}`, sub: `{a: [3, 1]}`, expected: true},
+		{name: "missing item", v: `{a: [1, 2]}`, sub: `{a: [4]}`, expected: false},
+		{name: "list and scalar", v: `{a: 1}`, sub: `{a: [1]}`, expected: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := contains(unmarshal(t, tc.v), unmarshal(t, tc.sub)); actual != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        string
+		sub      string
+		expected string
+	}{
+		{name: "equal values", m: `{a: 1, b: 2}`, sub: `{a: 1}`, expected: `{b: 2}`},
+		{name: "other values are kept", m: `{a: 1}`, sub: `{a: 2}`, expected: `{a: 1}`},
+		{name: "map entries", m: `{a: {b: 1, c: 2}}`, sub: `{a: {b: 1}}`, expected: `{a: {c: 2}}`},
+		{name: "emptied maps are removed", m: `{a: {b: 1}}`, sub: `{a: {b: 1}}`, expected: `{}`},
+		{name: "list items", m: `{a: [1, 2, 3]}`, sub: `{a: [2]}`, expected: `{a: [1, 3]}`},
+		{name: "emptied lists are removed", m: `{a: [1]}`, sub: `{a: [1, 2]}`, expected: `{}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _ := unmarshal(t, tc.m).(map[string]interface{})
+			sub, _ := unmarshal(t, tc.sub).(map[string]interface{})
+
+			if actual, expected := subtract(m, sub), unmarshal(t, tc.expected); !reflect.DeepEqual(actual, expected) {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestCommonKeys(t *testing.T) {
+	fields := []map[string]interface{}{
+		{"name": "unit", "image": "golang", "branches": []interface{}{"master"}, "command": []interface{}{"make"}},
+		{"name": "lint", "image": "golang", "branches": []interface{}{"master"}, "command": []interface{}{"lint"}},
+		{"name": "e2e", "image": "golang", "branches": []interface{}{"master"}},
+	}
+
+	expected := []string{"branches", "image"}
+	if actual := commonKeys(fields); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func unmarshal(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("unmarshal %s: %v", s, err)
+	}
+	return v
+}
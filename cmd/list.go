@@ -0,0 +1,306 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jmespath/go-jmespath"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/clarketm/pj/pkg/cli"
+	"github.com/clarketm/pj/pkg/prow"
+)
+
+var listShort = "List resolved jobs matching filters or a JMESPath query"
+
+var listLong = `List resolved jobs matching filters or a JMESPath query
+
+The jobs are resolved like create does. Each filter flag may be repeated and matches if any of its values do; a job
+is listed if it matches every filter. Values are glob patterns, where * matches any characters, and labels are
+given as key or key=value. With --jmespath, the filtered jobs are passed as a list to a JMESPath expression (see
+https://jmespath.org), whose result is printed as JSON.
+
+# List the presubmits of istio/istio running on release-1.7 which require gcp.
+pj list -g ./examples/requirements.yaml -i ./examples/jobs.yaml --repo istio/istio --type presubmit --branch release-1.7 --require gcp
+
+# List the names of the jobs using a build-tools image.
+pj list -i ./examples/jobs.yaml --image 'gcr.io/istio-testing/build-tools:*' --format name
+
+# List the privileged jobs with the branches they run on.
+pj list -i ./examples/jobs.yaml --jmespath '[?securityContext.privileged].{name: name, branches: branches}'
+`
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"query"},
+	Short:   listShort,
+	Long:    listLong,
+	RunE:    list,
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	addResolveFlags(listCmd, "")
+	markSharedConfig(listCmd)
+	listCmd.Flags().StringSlice("repo", nil, "Only list jobs of these repositories.")
+	listCmd.Flags().StringSlice("type", nil, "Only list jobs of these types (presubmit|postsubmit|periodic).")
+	listCmd.Flags().StringSlice("branch", nil, "Only list jobs running on these branches.")
+	listCmd.Flags().StringSlice("label", nil, "Only list jobs with these labels (key or key=value).")
+	listCmd.Flags().StringSlice("modifier", nil, "Only list jobs with these modifiers.")
+	listCmd.Flags().StringSlice("require", nil, "Only list jobs with these requirements, required directly or not.")
+	listCmd.Flags().StringSlice("cluster", nil, "Only list jobs running in these clusters.")
+	listCmd.Flags().StringSlice("image", nil, "Only list jobs with a container using these images.")
+	listCmd.Flags().String("format", "table", "Output format (table|json|name).")
+	listCmd.Flags().StringP("jmespath", "q", "", "JMESPath expression evaluated over the list of jobs.")
+}
+
+// jobFilter selects jobs by the values of their fields, given as glob patterns. Empty filters match every job.
+type jobFilter struct {
+	Repos     globs
+	Types     globs
+	Branches  globs
+	Labels    globs
+	Modifiers globs
+	Require   globs
+	Clusters  globs
+	Images    globs
+}
+
+// globs are glob patterns compiled to regular expressions, where * matches any characters and ? a single one.
+type globs []*regexp.Regexp
+
+func compileGlobs(patterns []string) globs {
+	var g globs
+	for _, pattern := range patterns {
+		g = append(g, regexp.MustCompile("^"+strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern))+"$"))
+	}
+	return g
+}
+
+func list(cmd *cobra.Command, args []string) error {
+	opts, err := getResolveOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	var filter jobFilter
+	for flag, patterns := range map[string]*globs{
+		"repo":     &filter.Repos,
+		"type":     &filter.Types,
+		"branch":   &filter.Branches,
+		"label":    &filter.Labels,
+		"modifier": &filter.Modifiers,
+		"require":  &filter.Require,
+		"cluster":  &filter.Clusters,
+		"image":    &filter.Images,
+	} {
+		values, err := cmd.Flags().GetStringSlice(flag)
+		if err != nil {
+			return errors.Wrapf(err, "getting %s flag", flag)
+		}
+		*patterns = compileGlobs(values)
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return errors.Wrapf(err, "getting format flag")
+	} else if format != "table" && format != "json" && format != "name" {
+		return fmt.Errorf("invalid format: %s (must be one of table|json|name)", format)
+	}
+
+	query, err := cmd.Flags().GetString("jmespath")
+	if err != nil {
+		return errors.Wrapf(err, "getting jmespath flag")
+	}
+
+	var expr *jmespath.JMESPath
+	if query != "" {
+		if expr, err = jmespath.Compile(query); err != nil {
+			return errors.Wrapf(err, "parsing jmespath expression")
+		}
+	}
+
+	jobs, diags := resolveJobs(opts)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	var matched []resolvedJob
+	for _, job := range jobs {
+		ok, err := filter.Match(job.Job)
+		if err != nil {
+			return err
+		}
+		if ok {
+			matched = append(matched, job)
+		}
+	}
+
+	if expr != nil {
+		return printQuery(cmd.OutOrStdout(), matched, expr)
+	}
+
+	switch format {
+	case "table":
+		return printTable(cmd.OutOrStdout(), matched)
+	case "json":
+		return printJSON(cmd.OutOrStdout(), matched)
+	}
+
+	for _, job := range matched {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s/%s\n", job.OrgRepo, job.Name)
+	}
+
+	return nil
+}
+
+// Match reports whether a job matches every filter.
+func (f jobFilter) Match(job *cli.Job) (bool, error) {
+	var modifiers, types []string
+	for _, m := range job.Modifiers {
+		modifiers = append(modifiers, string(m))
+	}
+	for _, t := range job.Types {
+		types = append(types, string(t))
+	}
+
+	images := []string{job.Image}
+	for _, c := range job.Containers {
+		images = append(images, c.Image)
+	}
+
+	require, err := prow.ExpandRequirements(job.Require, job.Requirements)
+	if err != nil {
+		return false, err
+	}
+
+	var labels []string
+	for k, v := range job.Labels {
+		labels = append(labels, k, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	for _, match := range []struct {
+		patterns globs
+		values   []string
+	}{
+		{f.Repos, []string{job.OrgRepo}},
+		{f.Types, types},
+		{f.Branches, job.Branches},
+		{f.Labels, labels},
+		{f.Modifiers, modifiers},
+		{f.Require, require},
+		{f.Clusters, []string{job.ClusterName}},
+		{f.Images, images},
+	} {
+		if !match.patterns.MatchAny(match.values) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// MatchAny reports whether any value matches any of the glob patterns, or whether there are no patterns.
+func (g globs) MatchAny(values []string) bool {
+	if len(g) == 0 {
+		return true
+	}
+
+	for _, re := range g {
+		for _, value := range values {
+			if re.MatchString(value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// printTable writes the jobs as a table of their main fields.
+func printTable(w io.Writer, jobs []resolvedJob) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "REPO\tTYPE\tNAME\tBRANCHES\tIMAGE\tSOURCE")
+	for _, job := range jobs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s:%d\n", job.OrgRepo, job.Types[0], job.Name, strings.Join(job.Branches, ","), job.Image, job.Source, job.Line)
+	}
+
+	return tw.Flush()
+}
+
+// printJSON writes the jobs as a JSON list.
+func printJSON(w io.Writer, jobs []resolvedJob) error {
+	values, err := jobValues(jobs)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, values)
+}
+
+// printQuery writes the result of a JMESPath expression evaluated over the list of jobs as JSON.
+func printQuery(w io.Writer, jobs []resolvedJob, expr *jmespath.JMESPath) error {
+	values, err := jobValues(jobs)
+	if err != nil {
+		return err
+	}
+
+	result, err := expr.Search(values)
+	if err != nil {
+		return errors.Wrapf(err, "evaluating jmespath expression")
+	}
+
+	return writeJSON(w, result)
+}
+
+// jobValues returns the unmarshaled representation of the jobs, without their requirements.
+func jobValues(jobs []resolvedJob) ([]interface{}, error) {
+	var values = make([]interface{}, 0, len(jobs))
+
+	for _, job := range jobs {
+		m, err := prow.JobToMap(*job.Job)
+		if err != nil {
+			return nil, errors.Wrapf(err, "job %s", job.Name)
+		}
+		delete(m, "requirements")
+
+		values = append(values, m)
+	}
+
+	return values, nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,131 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jmespath/go-jmespath"
+	"sigs.k8s.io/yaml"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+func TestJobFilter(t *testing.T) {
+	job := `
+repo: istio/istio
+name: unit
+types: [presubmit]
+branches: [master, release-1.8]
+labels: {preset-service-account: "true"}
+modifiers: [optional]
+require: [gcp]
+requirements:
+  gcp: {require: [docker]}
+  docker: {}
+clusterName: private
+image: gcr.io/istio-testing/build-tools:master
+containers: [{name: redis, image: redis:6}]
+`
+
+	tests := []struct {
+		name     string
+		filter   func(f *jobFilter)
+		expected bool
+	}{
+		{name: "empty filter", filter: func(f *jobFilter) {}, expected: true},
+		{name: "repo glob", filter: func(f *jobFilter) { f.Repos = compileGlobs([]string{"istio/*"}) }, expected: true},
+		{name: "other repo", filter: func(f *jobFilter) { f.Repos = compileGlobs([]string{"istio/api"}) }, expected: false},
+		{name: "any of the patterns", filter: func(f *jobFilter) { f.Types = compileGlobs([]string{"periodic", "presubmit"}) }, expected: true},
+		{name: "any of the branches", filter: func(f *jobFilter) { f.Branches = compileGlobs([]string{"release-1.?"}) }, expected: true},
+		{name: "label key", filter: func(f *jobFilter) { f.Labels = compileGlobs([]string{"preset-*"}) }, expected: true},
+		{name: "label key and value", filter: func(f *jobFilter) { f.Labels = compileGlobs([]string{"preset-service-account=false"}) }, expected: false},
+		{name: "modifier", filter: func(f *jobFilter) { f.Modifiers = compileGlobs([]string{"hidden"}) }, expected: false},
+		{name: "indirect requirement", filter: func(f *jobFilter) { f.Require = compileGlobs([]string{"docker"}) }, expected: true},
+		{name: "cluster", filter: func(f *jobFilter) { f.Clusters = compileGlobs([]string{"default"}) }, expected: false},
+		{name: "image of another container", filter: func(f *jobFilter) { f.Images = compileGlobs([]string{"redis:*"}) }, expected: true},
+		{name: "regular expression characters are literal", filter: func(f *jobFilter) { f.Images = compileGlobs([]string{"gcr.io/istio-testing/build-tools:.*"}) }, expected: false},
+		{
+			name: "every filter must match",
+			filter: func(f *jobFilter) {
+				f.Repos = compileGlobs([]string{"istio/istio"})
+				f.Clusters = compileGlobs([]string{"default"})
+			},
+			expected: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var j cli.Job
+			if err := yaml.Unmarshal([]byte(job), &j); err != nil {
+				t.Fatalf("unmarshal job: %v", err)
+			}
+
+			var f jobFilter
+			tc.filter(&f)
+
+			ok, err := f.Match(&j)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, ok)
+			}
+		})
+	}
+}
+
+func TestPrintQuery(t *testing.T) {
+	var unit, lint cli.Job
+	if err := yaml.Unmarshal([]byte(`{repo: org/repo, name: unit, require: [gcp], requirements: {gcp: {}}}`), &unit); err != nil {
+		t.Fatalf("unmarshal job: %v", err)
+	}
+	if err := yaml.Unmarshal([]byte(`{repo: org/repo, name: lint}`), &lint); err != nil {
+		t.Fatalf("unmarshal job: %v", err)
+	}
+	jobs := []resolvedJob{{Job: &unit}, {Job: &lint}}
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{query: "[].name", expected: "[\n  \"unit\",\n  \"lint\"\n]\n"},
+		{query: "[?require].name", expected: "[\n  \"unit\"\n]\n"},
+		{query: "[0].requirements", expected: "null\n"},
+		{query: "length(@)", expected: "2\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := printQuery(&b, jobs, jmespath.MustCompile(tc.query)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if b.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/clarketm/pj/pkg/cli"
+	pjerrors "github.com/clarketm/pj/pkg/errors"
+	"github.com/clarketm/pj/pkg/source"
+)
+
+// resolveOptions control how job configuration files are read and resolved.
+type resolveOptions struct {
+	Global  []string
+	Input   []string
+	Output  string
+	Profile string
+	Strict  bool
+	Verbose bool
+}
+
+// addResolveFlags registers the flags shared by commands which resolve job configuration. The output flag is only
+// registered with a non-empty default.
+func addResolveFlags(cmd *cobra.Command, output string) {
+	cmd.Flags().StringSliceP("global", "g", []string{}, "Global configuration files.")
+	cmd.Flags().StringSliceP("input", "i", []string{"/dev/stdin"}, "Input files and/or directories.")
+	if output != "" {
+		cmd.Flags().StringP("output", "o", output, "Output directory.")
+	}
+	cmd.Flags().Bool("strict", false, "Reject unknown fields in configuration files.")
+	cmd.Flags().String("profile", "", "Profile of the config file to use.")
+	markPathFlags(cmd, "global", "input", "output")
+}
+
+// addProfilesFlag registers the flag running a command for every profile of the config file.
+func addProfilesFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("all-profiles", false, "Run for every profile of the config file.")
+}
+
+// getResolveOptions reads the flags registered by addResolveFlags.
+func getResolveOptions(cmd *cobra.Command) (resolveOptions, error) {
+	var opts resolveOptions
+	var err error
+
+	if opts.Global, err = cmd.Flags().GetStringSlice("global"); err != nil {
+		return opts, errors.Wrapf(err, "getting global flag")
+	}
+
+	if opts.Input, err = cmd.Flags().GetStringSlice("input"); err != nil {
+		return opts, errors.Wrapf(err, "getting input flag")
+	}
+
+	if cmd.Flags().Lookup("output") != nil {
+		if opts.Output, err = cmd.Flags().GetString("output"); err != nil {
+			return opts, errors.Wrapf(err, "getting output flag")
+		}
+	}
+
+	if opts.Profile, err = cmd.Flags().GetString("profile"); err != nil {
+		return opts, errors.Wrapf(err, "getting profile flag")
+	}
+
+	if opts.Strict, err = cmd.Flags().GetBool("strict"); err != nil {
+		return opts, errors.Wrapf(err, "getting strict flag")
+	}
+
+	if opts.Verbose, err = cmd.Flags().GetBool("verbose"); err != nil {
+		return opts, errors.Wrapf(err, "getting verbose flag")
+	}
+
+	return opts, nil
+}
+
+// checkFields reports keys in a configuration file which do not correspond to any field, as errors in strict
+// mode and warnings otherwise.
+func checkFields(src *source.File, strict bool) pjerrors.Diagnostics {
+	var diags pjerrors.Diagnostics
+
+	severity := pjerrors.Warning
+	if strict {
+		severity = pjerrors.Error
+	}
+
+	for _, u := range src.UnknownFields(reflect.TypeOf(cli.JobConfiguration{})) {
+		diags.Add(pjerrors.Diagnostic{Severity: severity, File: src.Path, Line: u.Line, Column: u.Column}, u)
+	}
+
+	return diags
+}
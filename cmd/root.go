@@ -19,16 +19,19 @@
  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
  THE SOFTWARE.
 */
+
 package cmd
 
 import (
 	"fmt"
 	"os"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
+
+	pjerrors "github.com/clarketm/pj/pkg/errors"
+	pjlog "github.com/clarketm/pj/pkg/log"
 )
 
 const (
@@ -37,10 +40,13 @@ const (
 )
 
 var (
-	cfgFile   string
-	rootUse   = "pj"
-	rootShort = "ProwJob job manager"
-	rootLong  = "ProwJob job manager"
+	cfgFile     string
+	errorFormat string
+	logFormat   string
+	logger      = pjlog.New(os.Stderr, pjlog.Text, false)
+	rootUse     = "pj"
+	rootShort   = "ProwJob job manager"
+	rootLong    = "ProwJob job manager"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -49,48 +55,104 @@ var rootCmd = &cobra.Command{
 	Short: rootShort,
 	Long:  rootLong,
 	RunE:  root,
+
+	// Errors are printed by Execute, and usage only for invalid flags.
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		if err := applyConfig(cmd); err != nil {
+			return err
+		}
+		return setupLogger(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	err := rootCmd.Execute()
+
+	if diags, ok := err.(pjerrors.Diagnostics); ok {
+		format, ferr := pjerrors.ParseFormat(errorFormat)
+		if ferr != nil {
+			pjerrors.PrintErrAndExit(errors.Wrapf(ferr, "parsing error-format flag"))
+		}
+
+		if perr := diags.Print(os.Stderr, format); perr != nil {
+			pjerrors.PrintErrAndExit(perr)
+		}
+
+		if diags.HasErrors() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err != nil {
+		pjerrors.PrintErrAndExit(err)
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", fmt.Sprintf("Config file (default is $HOME/%s.yaml).", configName))
-	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Enable verbose output.")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", fmt.Sprintf("Config file (default is the nearest %s.yaml up to the repository root, or $HOME/%s.yaml).", configName, configName))
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Log every file read and written and every step of resolving jobs.")
 	rootCmd.PersistentFlags().Bool("version", false, "Version number.")
+	rootCmd.PersistentFlags().StringVar(&errorFormat, "error-format", string(pjerrors.Human), "Error output format (human|json|github).")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", string(pjlog.Text), "Log output format (text|json).")
 }
 
-// initConfig reads in config file and ENV variables if set.
+// initConfig reads in config file and ENV variables if set. Without --config, the nearest .pj.yaml from the current
+// directory up to the root of its repository is used, falling back to the home directory.
 func initConfig() {
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
 	} else {
-		// Find home directory.
-		home, err := homedir.Dir()
+		paths, err := configPaths()
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			pjerrors.PrintErrAndExit(err)
 		}
 
-		// Search config in home directory with name ".pj" (without extension).
-		viper.AddConfigPath(home)
+		// Search config with name ".pj" (without extension).
+		for _, path := range paths {
+			viper.AddConfigPath(path)
+		}
 		viper.SetConfigName(configName)
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// Read in environment variables that match, e.g. PJ_GLOBAL or PJ_CREATE_OUTPUT.
+	viper.SetEnvPrefix("pj")
+	viper.SetEnvKeyReplacer(envKeyReplacer)
+	viper.AutomaticEnv()
+
+	// If a config file is found, read it in. It is reported once the logger is set up.
+	if err := viper.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			pjerrors.PrintErrAndExit(errors.Wrapf(err, "reading config file"))
+		}
+	}
+}
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+// setupLogger configures the logger from the verbose and log-format flags. Logs are written to stderr.
+func setupLogger(cmd *cobra.Command) error {
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return errors.Wrapf(err, "getting verbose flag")
 	}
+
+	format, err := pjlog.ParseFormat(logFormat)
+	if err != nil {
+		return errors.Wrapf(err, "parsing log-format flag")
+	}
+
+	logger = pjlog.New(os.Stderr, format, verbose)
+
+	if viper.ConfigFileUsed() != "" {
+		logger.WithField("file", viper.ConfigFileUsed()).Debug("Using config file.")
+	}
+
+	return nil
 }
 
 func root(cmd *cobra.Command, args []string) error {
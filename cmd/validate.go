@@ -0,0 +1,158 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	prowapi "k8s.io/test-infra/prow/config"
+
+	pjerrors "github.com/clarketm/pj/pkg/errors"
+	"github.com/clarketm/pj/pkg/prow"
+)
+
+var validateShort = "Validate ProwJob yaml configuration"
+
+var validateLong = `Validate ProwJob yaml configuration
+
+Jobs are generated in memory and loaded through Prow's config loader, which applies the same defaulting and
+validation as Prow itself. Every problem is reported along with the job file and job name it originated from.
+
+# Validate ProwJobs using short options.
+pj validate -g ./examples/global1.yaml -i ./examples/jobs.yaml
+
+# Validate ProwJobs against an existing Prow configuration.
+pj validate -g ./examples/global1.yaml -i ./examples/jobs.yaml --prow-config ./config.yaml
+`
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: validateShort,
+	Long:  validateLong,
+	RunE:  validate,
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	addResolveFlags(validateCmd, "/dev/stdout")
+	markSharedConfig(validateCmd)
+	addProfilesFlag(validateCmd)
+	validateCmd.Flags().String("prow-config", "", "Prow configuration file used for validation.")
+	markPathFlags(validateCmd, "prow-config")
+}
+
+func validate(cmd *cobra.Command, args []string) error {
+	return runProfiles(cmd, validateProfile)
+}
+
+// validateProfile runs the validate command for the active profile.
+func validateProfile(cmd *cobra.Command) error {
+	opts, err := getResolveOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	prowConfig, err := cmd.Flags().GetString("prow-config")
+	if err != nil {
+		return errors.Wrapf(err, "getting prow-config flag")
+	}
+
+	jobs, diags := resolveJobs(opts)
+	prowjobs, bdiags := buildJobs(jobs)
+	diags = append(diags, bdiags...)
+	diags = append(diags, validateJobs(jobs, prowjobs, prowConfig)...)
+
+	return diags.Err()
+}
+
+// validateJobs validates all generated jobs together, as Prow would load them. Problems Prow attributes to a job are
+// reported at the job's definition.
+func validateJobs(jobs []resolvedJob, prowjobs map[string]*prow.ProwJobConfig, prowConfig string) pjerrors.Diagnostics {
+	var diags pjerrors.Diagnostics
+
+	var jobConfigs []prowapi.JobConfig
+	var errorList error
+	for _, path := range prow.SortedKeys(prowjobs) {
+		jobConfig, err := prowjobs[path].JobConfig()
+		if err != nil {
+			diags.Add(pjerrors.Diagnostic{File: path}, err)
+			continue
+		}
+		jobConfigs = append(jobConfigs, jobConfig)
+
+		if err := prow.ValidatePresubmits(prowjobs[path].Presubmits); err != nil {
+			errorList = multierror.Append(errorList, err)
+		}
+	}
+
+	if err := prow.Validate(prow.MergeJobConfigs(jobConfigs...), prowConfig); err != nil {
+		errorList = multierror.Append(errorList, err)
+	}
+
+	var vdiags pjerrors.Diagnostics
+
+	if merr, ok := errorList.(*multierror.Error); ok {
+		for _, err := range merr.Errors {
+			vdiags = append(vdiags, validationDiagnostics(jobs, err)...)
+		}
+	}
+
+	// Report problems in the order the jobs are defined.
+	sort.SliceStable(vdiags, func(i, j int) bool {
+		if vdiags[i].File != vdiags[j].File {
+			return vdiags[i].File < vdiags[j].File
+		}
+		return vdiags[i].Line < vdiags[j].Line
+	})
+
+	return append(diags, vdiags...)
+}
+
+// validationDiagnostics locates a validation error at the definition of the job it is about, or reports it without a
+// location if it is not about a job. Prow does not name the repository in most errors, in which case the error is
+// located at every job of that name.
+func validationDiagnostics(jobs []resolvedJob, err error) pjerrors.Diagnostics {
+	var diags pjerrors.Diagnostics
+
+	if jerr, ok := err.(prow.JobError); ok {
+		for _, job := range jobs {
+			if job.Name == jerr.Job && (jerr.Repo == "" || job.OrgRepo == jerr.Repo) {
+				diag := job.diagnostic()
+				if jerr.Warning {
+					diag.Severity = pjerrors.Warning
+				}
+				diags.Add(diag, jerr.Err)
+			}
+		}
+		if len(diags) > 0 {
+			return diags
+		}
+	}
+
+	diags.Add(pjerrors.Diagnostic{}, errors.Wrapf(err, "validating generated jobs"))
+	return diags
+}
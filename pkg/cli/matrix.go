@@ -0,0 +1,130 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	MatrixInclude = "include"
+	MatrixExclude = "exclude"
+)
+
+// Matrix expands a job into one job per combination of its axis values. It is written like a GitHub Actions
+// matrix: every key is an axis listing its values, except for the `include` and `exclude` lists of combinations.
+type Matrix struct {
+	Axes    map[string][]string
+	Include []map[string]string
+	Exclude []map[string]string
+}
+
+func (m Matrix) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{})
+
+	for axis, values := range m.Axes {
+		out[axis] = values
+	}
+	if len(m.Include) > 0 {
+		out[MatrixInclude] = m.Include
+	}
+	if len(m.Exclude) > 0 {
+		out[MatrixExclude] = m.Exclude
+	}
+
+	return json.Marshal(out)
+}
+
+func (m *Matrix) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	for key, value := range raw {
+		switch key {
+		case MatrixInclude, MatrixExclude:
+			var combinations []map[string]interface{}
+			if err := decode(value, &combinations); err != nil {
+				return fmt.Errorf("matrix %s: %v", key, err)
+			}
+
+			for _, c := range combinations {
+				combination := make(map[string]string)
+				for axis, v := range c {
+					s, err := scalar(v)
+					if err != nil {
+						return fmt.Errorf("matrix %s: %s: %v", key, axis, err)
+					}
+					combination[axis] = s
+				}
+
+				if key == MatrixInclude {
+					m.Include = append(m.Include, combination)
+				} else {
+					m.Exclude = append(m.Exclude, combination)
+				}
+			}
+		default:
+			var values []interface{}
+			if err := decode(value, &values); err != nil {
+				return fmt.Errorf("matrix axis %s: %v", key, err)
+			}
+
+			if m.Axes == nil {
+				m.Axes = make(map[string][]string)
+			}
+
+			m.Axes[key] = []string{}
+			for _, v := range values {
+				s, err := scalar(v)
+				if err != nil {
+					return fmt.Errorf("matrix axis %s: %v", key, err)
+				}
+				m.Axes[key] = append(m.Axes[key], s)
+			}
+		}
+	}
+
+	return nil
+}
+
+// decode unmarshals json keeping numbers as written.
+func decode(b []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// scalar formats a matrix value, which must be a string, number or boolean.
+func scalar(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case json.Number, bool:
+		return fmt.Sprint(t), nil
+	}
+	return "", fmt.Errorf("value must be a string, number or boolean: %v", v)
+}
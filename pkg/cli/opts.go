@@ -23,11 +23,13 @@
 package cli
 
 import (
+	"encoding/json"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	prowv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	prowapi "k8s.io/test-infra/prow/config"
 )
 
 type Modifier string
@@ -47,6 +49,18 @@ const (
 	Periodic   JobType = "periodic"
 )
 
+// MergeStrategy controls how a list or map field of a job is combined with the same field inherited from
+// file-level defaults, global configuration and requirements.
+type MergeStrategy string
+
+const (
+	Append      MergeStrategy = "append"
+	Prepend     MergeStrategy = "prepend"
+	Replace     MergeStrategy = "replace"
+	Merge       MergeStrategy = "merge"
+	MergeByName MergeStrategy = "merge-by-name"
+)
+
 type Empty *struct{}
 
 type Defaults Job
@@ -60,6 +74,12 @@ type JobCore struct {
 	metav1.ObjectMeta
 	corev1.Container
 	corev1.PodSpec
+
+	// SecurityContext is declared on both `corev1.Container` and `corev1.PodSpec`; the container field is
+	// exposed explicitly so that it is not dropped as an ambiguous json field, and the pod field is exposed as
+	// PodSecurityContext.
+	SecurityContext    *corev1.SecurityContext    `json:"securityContext,omitempty"`
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
 }
 
 type JobProw struct {
@@ -70,27 +90,49 @@ type JobProw struct {
 	Command        []string          `json:"command,omitempty"`
 	Branch         string            `json:"branch,omitempty"`
 	Branches       []string          `json:"branches,omitempty"`
+	BranchSuffix   string            `json:"branch_suffix,omitempty"`
 	SkipBranches   []string          `json:"skip_branches,omitempty"`
-	ExtraRepos     []string          `json:"extra_repos,omitempty"`
+	ExtraRepos     []ExtraRepo       `json:"extra_repos,omitempty"`
 	Require        []string          `json:"require,omitempty"`
+	Presets        *bool             `json:"presets,omitempty"`
 	OrgRepo        string            `json:"repo,omitempty"`
 	Name           string            `json:"name,omitempty"`
+	Extends        string            `json:"extends,omitempty"`
+	Matrix         *Matrix           `json:"matrix,omitempty"`
 	CloneTemplate  string            `json:"clone_tmpl,omitempty"`
+	PathAlias      string            `json:"path_alias,omitempty"`
+	Decorate       *bool             `json:"decorate,omitempty"`
+	SkipSubmodules *bool             `json:"skip_submodules,omitempty"`
+	SkipCloning    *bool             `json:"skip_cloning,omitempty"`
+	CloneDepth     *int              `json:"clone_depth,omitempty"`
+	SSHKeySecrets  []string          `json:"ssh_key_secrets,omitempty"`
 	OutputTemplate string            `json:"output_tmpl,omitempty"`
+	Plugins        []string          `json:"plugins,omitempty"`
 	Image          string            `json:"image,omitempty"`
 	Regex          string            `json:"regex,omitempty"`
+	AlwaysRun      *bool             `json:"always_run,omitempty"`
+	RunBeforeMerge *bool             `json:"run_before_merge,omitempty"`
 	Trigger        string            `json:"trigger,omitempty"`
 	RerunCommand   string            `json:"rerun_command,omitempty"`
 	MaxConcurrency int               `json:"max_concurrency,omitempty"`
 	Aliases        map[string]string `json:"aliases,omitempty"`
 	Requirements   map[string]Job    `json:"requirements,omitempty"`
+	Vars           map[string]string `json:"vars,omitempty"`
 	Type           JobType           `json:"type,omitempty"`
 	Types          []JobType         `json:"types,omitempty"`
 	Modifiers      []Modifier        `json:"modifiers,omitempty"`
+
+	SkipIfOnlyChanged    string                   `json:"skip_if_only_changed,omitempty"`
+	Tide                 *prowapi.TideQuery       `json:"tide,omitempty"`
+	ProwConfigTemplate   string                   `json:"prow_config_tmpl,omitempty"`
+	PluginConfigTemplate string                   `json:"plugin_config_tmpl,omitempty"`
+	BranchOverrides      map[string]Job           `json:"branch_overrides,omitempty"`
+	MergeStrategies      map[string]MergeStrategy `json:"merge,omitempty"`
 }
 
 type JobPeriodic struct {
 	Cron     string `json:"cron,omitempty"`
+	CronTZ   string `json:"cron_tz,omitempty"`
 	Interval string `json:"interval,omitempty"`
 }
 
@@ -107,3 +149,16 @@ func (j *Job) Org() string {
 func (j *Job) Repo() string {
 	return strings.Split(j.OrgRepo, "/")[1]
 }
+
+// DeepCopy returns a copy of the job which shares no maps, slices or pointers with the original.
+func (j Job) DeepCopy() (Job, error) {
+	var c Job
+
+	b, err := json.Marshal(j)
+	if err != nil {
+		return c, err
+	}
+
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
@@ -0,0 +1,120 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ExtraRepo is an additional repository cloned by a job. It is written either as an `org/repo@ref` string or as an
+// object, which can also pin a SHA and configure how the repository is cloned.
+type ExtraRepo struct {
+	OrgRepo   string `json:"repo"`
+	Ref       string `json:"ref,omitempty"`
+	SHA       string `json:"sha,omitempty"`
+	PathAlias string `json:"path_alias,omitempty"`
+	CloneURI  string `json:"clone_uri,omitempty"`
+	WorkDir   bool   `json:"workdir,omitempty"`
+}
+
+// ParseExtraRepo parses the short `org/repo@ref` form of an extra repository; the ref is optional.
+func ParseExtraRepo(s string) ExtraRepo {
+	parts := strings.SplitN(s, "@", 2)
+
+	repo := ExtraRepo{OrgRepo: parts[0]}
+	if len(parts) > 1 {
+		repo.Ref = parts[1]
+	}
+
+	return repo
+}
+
+// String returns the short `org/repo@ref` form of the extra repository.
+func (r ExtraRepo) String() string {
+	if r.Ref == "" {
+		return r.OrgRepo
+	}
+	return r.OrgRepo + "@" + r.Ref
+}
+
+// Short reports whether the extra repository can be written in the short form.
+func (r ExtraRepo) Short() bool {
+	return r == ExtraRepo{OrgRepo: r.OrgRepo, Ref: r.Ref}
+}
+
+// Org returns the organization of the extra repository.
+func (r ExtraRepo) Org() string {
+	return strings.Split(r.OrgRepo, "/")[0]
+}
+
+// Repo returns the repository name of the extra repository.
+func (r ExtraRepo) Repo() string {
+	parts := strings.SplitN(r.OrgRepo, "/", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// Validate checks that the repository is written as `org/repo`.
+func (r ExtraRepo) Validate() error {
+	parts := strings.Split(r.OrgRepo, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid repo %q: expected org/repo", r.OrgRepo)
+	}
+	return nil
+}
+
+// DecodesFields marks the object form of an extra repository as decoded into its json fields, so unknown keys in it
+// are still reported.
+func (ExtraRepo) DecodesFields() {}
+
+func (r ExtraRepo) MarshalJSON() ([]byte, error) {
+	if r.Short() {
+		return json.Marshal(r.String())
+	}
+
+	type extraRepo ExtraRepo
+	return json.Marshal(extraRepo(r))
+}
+
+func (r *ExtraRepo) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*r = ParseExtraRepo(s)
+		return nil
+	}
+
+	type extraRepo ExtraRepo
+	var repo extraRepo
+
+	// Unknown fields are reported by the strict checker with the file, line and suggestions of the other fields.
+	if err := json.Unmarshal(b, &repo); err != nil {
+		return fmt.Errorf("extra repo must be an org/repo@ref string or an object: %v", err)
+	}
+
+	*r = ExtraRepo(repo)
+	return nil
+}
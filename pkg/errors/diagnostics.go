@@ -0,0 +1,223 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+type Format string
+
+const (
+	Human  Format = "human"
+	JSON   Format = "json"
+	GitHub Format = "github"
+)
+
+// Formats are the supported diagnostic output formats.
+var Formats = []Format{Human, JSON, GitHub}
+
+// Diagnostic is a problem found in a job configuration, along with where it was found.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Job      string   `json:"job,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) Error() string {
+	var b strings.Builder
+
+	if d.File != "" {
+		b.WriteString(d.File)
+		if d.Line > 0 {
+			_, _ = fmt.Fprintf(&b, ":%d", d.Line)
+			if d.Column > 0 {
+				_, _ = fmt.Fprintf(&b, ":%d", d.Column)
+			}
+		}
+		b.WriteString(": ")
+	}
+
+	if d.Job != "" {
+		_, _ = fmt.Fprintf(&b, "job %s: ", d.Job)
+	}
+
+	b.WriteString(d.Message)
+
+	return b.String()
+}
+
+// Diagnostics accumulates every problem found while processing job configuration.
+type Diagnostics []Diagnostic
+
+func (d Diagnostics) Error() string {
+	var lines []string
+	for _, diag := range d {
+		lines = append(lines, fmt.Sprintf("%s: %s", diag.Severity, diag.Error()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Add records an error, using d as a template for its location. Aggregated errors are recorded individually.
+func (d *Diagnostics) Add(diag Diagnostic, err error) {
+	if err == nil {
+		return
+	}
+
+	if diag.Severity == "" {
+		diag.Severity = Error
+	}
+
+	switch e := err.(type) {
+	case Diagnostics:
+		*d = append(*d, e...)
+	case Diagnostic:
+		*d = append(*d, e)
+	case *multierror.Error:
+		for _, err := range e.Errors {
+			d.Add(diag, err)
+		}
+	case utilerrors.Aggregate:
+		for _, err := range e.Errors() {
+			d.Add(diag, err)
+		}
+	default:
+		diag.Message = err.Error()
+		*d = append(*d, diag)
+	}
+}
+
+// Addf records a formatted message, using d as a template for its location.
+func (d *Diagnostics) Addf(diag Diagnostic, format string, args ...interface{}) {
+	d.Add(diag, fmt.Errorf(format, args...))
+}
+
+// HasErrors reports whether any diagnostic has error severity.
+func (d Diagnostics) HasErrors() bool {
+	for _, diag := range d {
+		if diag.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the diagnostics as an error, or nil if there are none.
+func (d Diagnostics) Err() error {
+	if len(d) == 0 {
+		return nil
+	}
+	return d
+}
+
+// Print writes the diagnostics in the given format.
+func (d Diagnostics) Print(w io.Writer, format Format) error {
+	switch format {
+	case JSON:
+		b, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case GitHub:
+		for _, diag := range d {
+			if _, err := fmt.Fprintln(w, diag.annotation()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Human:
+		fallthrough
+	default:
+		for _, diag := range d {
+			if _, err := fmt.Fprintf(w, "%s: %s\n", diag.Severity, diag.Error()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// ParseFormat returns the diagnostic format with the given name.
+func ParseFormat(s string) (Format, error) {
+	for _, format := range Formats {
+		if Format(s) == format {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("invalid format: %s", s)
+}
+
+// annotation formats the diagnostic as a GitHub Actions workflow command.
+func (d Diagnostic) annotation() string {
+	var props []string
+
+	if d.File != "" {
+		props = append(props, "file="+escapeProperty(d.File))
+	}
+	if d.Line > 0 {
+		props = append(props, fmt.Sprintf("line=%d", d.Line))
+	}
+	if d.Column > 0 {
+		props = append(props, fmt.Sprintf("col=%d", d.Column))
+	}
+	if d.Job != "" {
+		props = append(props, "title="+escapeProperty("job "+d.Job))
+	}
+
+	command := "error"
+	if d.Severity == Warning {
+		command = "warning"
+	}
+
+	if len(props) > 0 {
+		command += " " + strings.Join(props, ",")
+	}
+
+	return fmt.Sprintf("::%s::%s", command, escapeData(d.Message))
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,176 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package errors
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+func TestPrint(t *testing.T) {
+	diags := Diagnostics{
+		{Severity: Error, File: "jobs.yaml", Line: 6, Column: 3, Job: "unit", Message: "unknown requirement: gcp"},
+		{Severity: Warning, File: "jobs.yaml", Line: 2, Message: "unknown field \"imge\" (did you mean \"image\"?)"},
+		{Severity: Error, Message: "100% of jobs failed:\nsee above"},
+		{Severity: Error, File: "dir,with:colon/jobs.yaml", Job: "e2e"},
+	}
+
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{
+			format: Human,
+			expected: `error: jobs.yaml:6:3: job unit: unknown requirement: gcp
+warning: jobs.yaml:2: unknown field "imge" (did you mean "image"?)
+error: 100% of jobs failed:
+see above
+error: dir,with:colon/jobs.yaml: job e2e: 
+`,
+		},
+		{
+			format: JSON,
+			expected: `[
+  {
+    "severity": "error",
+    "file": "jobs.yaml",
+    "line": 6,
+    "column": 3,
+    "job": "unit",
+    "message": "unknown requirement: gcp"
+  },
+  {
+    "severity": "warning",
+    "file": "jobs.yaml",
+    "line": 2,
+    "message": "unknown field \"imge\" (did you mean \"image\"?)"
+  },
+  {
+    "severity": "error",
+    "message": "100% of jobs failed:\nsee above"
+  },
+  {
+    "severity": "error",
+    "file": "dir,with:colon/jobs.yaml",
+    "job": "e2e",
+    "message": ""
+  }
+]
+`,
+		},
+		{
+			format: GitHub,
+			expected: `::error file=jobs.yaml,line=6,col=3,title=job unit::unknown requirement: gcp
+::warning file=jobs.yaml,line=2::unknown field "imge" (did you mean "image"?)
+::error::100%25 of jobs failed:%0Asee above
+::error file=dir%2Cwith%3Acolon/jobs.yaml,title=job e2e::
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.format), func(t *testing.T) {
+			var b bytes.Buffer
+			if err := diags.Print(&b, tc.format); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if b.String() != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, b.String())
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Format
+		err      bool
+	}{
+		{name: "human", expected: Human},
+		{name: "json", expected: JSON},
+		{name: "github", expected: GitHub},
+		{name: "JSON", err: true},
+		{name: "", err: true},
+		{name: "text", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			format, err := ParseFormat(tc.name)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if format != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, format)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	location := Diagnostic{File: "jobs.yaml", Line: 3, Job: "unit"}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected Diagnostics
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name:     "error",
+			err:      fmt.Errorf("invalid"),
+			expected: Diagnostics{{Severity: Error, File: "jobs.yaml", Line: 3, Job: "unit", Message: "invalid"}},
+		},
+		{
+			name: "multierror",
+			err:  multierror.Append(fmt.Errorf("first"), fmt.Errorf("second")),
+			expected: Diagnostics{
+				{Severity: Error, File: "jobs.yaml", Line: 3, Job: "unit", Message: "first"},
+				{Severity: Error, File: "jobs.yaml", Line: 3, Job: "unit", Message: "second"},
+			},
+		},
+		{
+			name:     "diagnostic keeps its own location",
+			err:      Diagnostic{Severity: Warning, File: "other.yaml", Message: "unknown field"},
+			expected: Diagnostics{{Severity: Warning, File: "other.yaml", Message: "unknown field"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var diags Diagnostics
+			diags.Add(location, tc.err)
+
+			if !reflect.DeepEqual(diags, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, diags)
+			}
+		})
+	}
+}
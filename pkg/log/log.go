@@ -0,0 +1,80 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Format string
+
+const (
+	Text Format = "text"
+	JSON Format = "json"
+)
+
+// Formats are the supported log output formats.
+var Formats = []Format{Text, JSON}
+
+// New returns a logger writing to w. Warnings, errors and reports of what a command changed are logged at the info
+// level and above, unless verbose, in which case every file read and written and every step of resolving jobs is
+// logged as well.
+func New(w io.Writer, format Format, verbose bool) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(w)
+
+	if format == JSON {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+	}
+
+	if verbose {
+		logger.SetLevel(logrus.DebugLevel)
+	} else {
+		logger.SetLevel(logrus.InfoLevel)
+	}
+
+	return logger
+}
+
+// Discard returns a logger which logs nothing, for resolving jobs whose steps are not worth reporting.
+func Discard() *logrus.Entry {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return logrus.NewEntry(logger)
+}
+
+// ParseFormat parses a log output format.
+func ParseFormat(s string) (Format, error) {
+	for _, format := range Formats {
+		if Format(s) == format {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("invalid format: %s", s)
+}
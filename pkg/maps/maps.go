@@ -46,3 +46,35 @@ func GetOrDefault(m map[string]string, key string, def string) string {
 		return v
 	}
 }
+
+// Prune recursively removes nil values, empty strings and empty lists from an unmarshaled value.
+func Prune(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			e = Prune(e)
+			if isEmpty(e) {
+				delete(t, k)
+				continue
+			}
+			t[k] = e
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = Prune(e)
+		}
+	}
+	return v
+}
+
+func isEmpty(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case []interface{}:
+		return len(t) == 0
+	}
+	return false
+}
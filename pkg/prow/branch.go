@@ -0,0 +1,168 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+// ResolveBranches resolves a job as ResolveJob does and sets its defaults, then splits off a separate job for every
+// branch matched by one of its branch overrides. Each branch job is the job with the override applied on top of it,
+// restricted to that branch and named with the branch suffix; it is resolved on its own, so an override may also
+// require additional requirements. The job keeps the branches without an override, and is omitted if none remain.
+// Each override applied is logged at debug level.
+func ResolveBranches(log *logrus.Entry, job cli.Job, defaults cli.Job, global cli.Job) ([]cli.Job, error) {
+	base, err := job.DeepCopy()
+	if err != nil {
+		return nil, errors.Wrapf(err, "copy job: %s", job.Name)
+	}
+
+	if err := ResolveJob(log, &base, defaults, global); err != nil {
+		return nil, err
+	}
+	SetDefaults(&base)
+
+	if len(base.BranchOverrides) == 0 {
+		return []cli.Job{base}, nil
+	}
+
+	var jobs []cli.Job
+	var branches []string
+
+	for _, branch := range base.Branches {
+		key, err := BranchOverride(base.BranchOverrides, branch)
+		if err != nil {
+			return nil, err
+		} else if key == "" {
+			branches = append(branches, branch)
+			continue
+		}
+
+		branchLog := log.WithFields(logrus.Fields{"branch": branch, "override": key})
+		branchLog.Debug("Applying branch override.")
+
+		branchJob, err := overrideBranch(job, base, branch, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "branch %s", branch)
+		}
+
+		if err := ResolveJob(branchLog, &branchJob, defaults, global); err != nil {
+			return nil, errors.Wrapf(err, "branch %s", branch)
+		}
+		restrictBranch(&branchJob, branch)
+		SetDefaults(&branchJob)
+
+		jobs = append(jobs, branchJob)
+	}
+
+	if len(branches) == 0 {
+		return jobs, nil
+	}
+
+	base.Branch = ""
+	base.Branches = branches
+
+	return append([]cli.Job{base}, jobs...), nil
+}
+
+// overrideBranch returns the unresolved job for a branch: the override on top of the job, restricted to the branch.
+func overrideBranch(job cli.Job, base cli.Job, branch, key string) (cli.Job, error) {
+	override, err := base.BranchOverrides[key].DeepCopy()
+	if err != nil {
+		return override, errors.Wrapf(err, "copy branch override: %s", key)
+	}
+
+	parent, err := job.DeepCopy()
+	if err != nil {
+		return override, errors.Wrapf(err, "copy job: %s", job.Name)
+	}
+
+	if override.Name == "" {
+		suffix := base.BranchSuffix
+		if suffix == "" {
+			suffix = DefaultBranchSuffix
+		}
+		override.Name = parent.Name + suffix
+	}
+
+	if err := MergeFields(&override, parent); err != nil {
+		return override, errors.Wrapf(err, "merge branch override: %s", key)
+	}
+
+	restrictBranch(&override, branch)
+
+	return override, nil
+}
+
+// restrictBranch restricts a job to a single branch, dropping any branch configuration it inherited.
+func restrictBranch(job *cli.Job, branch string) {
+	job.Branch = ""
+	job.Branches = []string{branch}
+	job.SkipBranches = nil
+	job.BranchOverrides = nil
+}
+
+// BranchOverride returns the key of the override matching a branch, or an empty key if there is none. A key equal
+// to the branch takes precedence over keys matching it as a regular expression; a branch matched by several regular
+// expressions is an error.
+func BranchOverride(overrides map[string]cli.Job, branch string) (string, error) {
+	if _, exists := overrides[branch]; exists {
+		return branch, nil
+	}
+
+	var keys []string
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var matched []string
+
+	for _, key := range keys {
+		re, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", key))
+		if err != nil {
+			return "", errors.Wrapf(err, "branch override %s", key)
+		}
+
+		if re.MatchString(branch) {
+			matched = append(matched, key)
+		}
+	}
+
+	switch len(matched) {
+	case 0:
+		return "", nil
+	case 1:
+		return matched[0], nil
+	}
+
+	return "", fmt.Errorf("branch %s matches several branch overrides: %s", branch, strings.Join(matched, ", "))
+}
@@ -23,8 +23,13 @@
 package prow
 
 import (
+	"fmt"
 	"sort"
+	"strings"
 
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	prowapi "k8s.io/test-infra/prow/config"
 
 	"github.com/clarketm/pj/pkg/cli"
@@ -35,23 +40,69 @@ type SortOrder string
 const (
 	Ascending  SortOrder = "asc"
 	Descending SortOrder = "desc"
+	Source     SortOrder = "source"
 )
 
+// SortOrders are the supported job orderings. Source preserves the order jobs are defined in the input files.
+var SortOrders = []SortOrder{Ascending, Descending, Source}
+
+// Presubmit is a Prow presubmit with the triggers of Prow versions newer than the one pj validates against.
+type Presubmit struct {
+	prowapi.Presubmit
+
+	SkipIfOnlyChanged string `json:"skip_if_only_changed,omitempty"`
+	RunBeforeMerge    bool   `json:"run_before_merge,omitempty"`
+}
+
+// OutputConfig is the job configuration written by pj.
+type OutputConfig struct {
+	Presubmits  map[string][]Presubmit          `json:"presubmits,omitempty"`
+	Postsubmits map[string][]prowapi.Postsubmit `json:"postsubmits,omitempty"`
+	Periodics   []prowapi.Periodic              `json:"periodics,omitempty"`
+	Presets     []prowapi.Preset                `json:"presets,omitempty"`
+
+	Tide             *TideConfig               `json:"tide,omitempty"`
+	BranchProtection *prowapi.BranchProtection `json:"branch-protection,omitempty"`
+	Plugins          map[string][]string       `json:"plugins,omitempty"`
+}
+
 type ProwJobConfig struct {
-	Presubmits  map[string][]prowapi.Presubmit
+	Presubmits  map[string][]Presubmit
 	Postsubmits map[string][]prowapi.Postsubmit
 	Periodics   []prowapi.Periodic
+	Presets     []prowapi.Preset
+
+	Tide             map[string]prowapi.TideQuery
+	RequiredContexts map[string]map[string]sets.String
+	Plugins          map[string]sets.String
 }
 
 func NewProwJobConfig() *ProwJobConfig {
 	var pjc ProwJobConfig
-	pjc.Presubmits = make(map[string][]prowapi.Presubmit)
+	pjc.Presubmits = make(map[string][]Presubmit)
 	pjc.Postsubmits = make(map[string][]prowapi.Postsubmit)
+	pjc.Tide = make(map[string]prowapi.TideQuery)
+	pjc.RequiredContexts = make(map[string]map[string]sets.String)
+	pjc.Plugins = make(map[string]sets.String)
 	return &pjc
 }
 
 func (o *ProwJobConfig) Empty() bool {
-	return len(o.Presubmits) == 0 && len(o.Postsubmits) == 0 && len(o.Periodics) == 0
+	return len(o.Presubmits) == 0 && len(o.Postsubmits) == 0 && len(o.Periodics) == 0 && len(o.Presets) == 0 &&
+		len(o.Tide) == 0 && len(o.RequiredContexts) == 0 && len(o.Plugins) == 0
+}
+
+func (o *ProwJobConfig) AddJob(job *cli.Job) {
+	for _, jobType := range job.Types {
+		switch jobType {
+		case cli.Postsubmit:
+			o.AddPostsubmit(job.OrgRepo, job)
+		case cli.Periodic:
+			o.AddPeriodic(job)
+		case cli.Presubmit:
+			o.AddPresubmit(job.OrgRepo, job)
+		}
+	}
 }
 
 func (o *ProwJobConfig) AddPresubmit(orgrepo string, job *cli.Job) {
@@ -66,9 +117,58 @@ func (o *ProwJobConfig) AddPeriodic(job *cli.Job) {
 	o.Periodics = append(o.Periodics, CreatePeriodic(job))
 }
 
+func (o *ProwJobConfig) JobConfig() (prowapi.JobConfig, error) {
+	var jobConfig prowapi.JobConfig
+	var errorList error
+
+	var presubmits = make(map[string][]prowapi.Presubmit)
+	for orgrepo, jobs := range o.Presubmits {
+		for _, job := range jobs {
+			presubmits[orgrepo] = append(presubmits[orgrepo], job.Presubmit)
+		}
+	}
+
+	if err := jobConfig.SetPresubmits(presubmits); err != nil {
+		errorList = multierror.Append(errorList, errors.Wrapf(err, "setting presubmits"))
+	}
+
+	if err := jobConfig.SetPostsubmits(o.Postsubmits); err != nil {
+		errorList = multierror.Append(errorList, errors.Wrapf(err, "setting postsubmits"))
+	}
+
+	jobConfig.Periodics = o.Periodics
+	jobConfig.Presets = o.Presets
+
+	return jobConfig, errorList
+}
+
+// OutputConfig returns the configuration to write. Unlike JobConfig, it keeps the presubmit triggers unknown to
+// Prow's job configuration, along with the Tide, branch protection and plugin configuration of the repositories.
+func (o *ProwJobConfig) OutputConfig() OutputConfig {
+	return OutputConfig{
+		Presubmits:  o.Presubmits,
+		Postsubmits: o.Postsubmits,
+		Periodics:   o.Periodics,
+		Presets:     o.Presets,
+
+		Tide:             o.tideConfig(),
+		BranchProtection: o.branchProtection(),
+		Plugins:          o.pluginConfig(),
+	}
+}
+
+// Sort orders the jobs of each type. Jobs which compare equal keep their source order, so the result is
+// identical across runs.
+func (o *ProwJobConfig) Sort(order SortOrder) {
+	o.SortPresubmit(order)
+	o.SortPostsubmit(order)
+	o.SortPeriodic(order)
+	o.SortPresets(order)
+}
+
 func (o *ProwJobConfig) SortPresubmit(order SortOrder) {
 	for _, c := range o.Presubmits {
-		sort.Slice(c, func(a, b int) bool {
+		sort.SliceStable(c, func(a, b int) bool {
 			return comparator(order)(c[a].Name, c[b].Name)
 		})
 	}
@@ -76,23 +176,51 @@ func (o *ProwJobConfig) SortPresubmit(order SortOrder) {
 
 func (o *ProwJobConfig) SortPostsubmit(order SortOrder) {
 	for _, c := range o.Postsubmits {
-		sort.Slice(c, func(a, b int) bool {
+		sort.SliceStable(c, func(a, b int) bool {
 			return comparator(order)(c[a].Name, c[b].Name)
 		})
 	}
 }
 
 func (o *ProwJobConfig) SortPeriodic(order SortOrder) {
-	sort.Slice(o.Periodics, func(a, b int) bool {
+	sort.SliceStable(o.Periodics, func(a, b int) bool {
 		return comparator(order)(o.Periodics[a].Name, o.Periodics[b].Name)
 	})
 }
 
+func (o *ProwJobConfig) SortPresets(order SortOrder) {
+	sort.SliceStable(o.Presets, func(a, b int) bool {
+		return comparator(order)(presetName(o.Presets[a]), presetName(o.Presets[b]))
+	})
+}
+
+// ParseSortOrder returns the sort order with the given name.
+func ParseSortOrder(s string) (SortOrder, error) {
+	for _, order := range SortOrders {
+		if SortOrder(s) == order {
+			return order, nil
+		}
+	}
+	return "", fmt.Errorf("invalid sort order: %s (must be one of %s)", s, joinSortOrders(SortOrders, "|"))
+}
+
+func joinSortOrders(orders []SortOrder, sep string) string {
+	var s []string
+	for _, order := range orders {
+		s = append(s, string(order))
+	}
+	return strings.Join(s, sep)
+}
+
 func comparator(order SortOrder) func(a, b string) bool {
 	switch order {
+	case Source:
+		return func(a, b string) bool {
+			return false
+		}
 	case Descending:
 		return func(a, b string) bool {
-			return a < b
+			return a > b
 		}
 	case Ascending:
 		fallthrough
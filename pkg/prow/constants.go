@@ -23,8 +23,10 @@
 package prow
 
 const (
-	AutogenHeader = "# THIS FILE IS AUTOGENERATED. DO NOT EDIT.\n"
-	DefaultBranch = "master"
-	DefaultOutput = "prowjobs.yaml"
-	YamlExt       = ".ya?ml$"
+	AutogenHeader       = "# THIS FILE IS AUTOGENERATED. DO NOT EDIT.\n"
+	DefaultBranch       = "master"
+	DefaultBranchSuffix = "-{{.Branch}}"
+	DefaultOutput       = "prowjobs.yaml"
+	DefaultPresets      = "presets.yaml"
+	YamlExt             = ".ya?ml$"
 )
@@ -0,0 +1,124 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	prowv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	prowapi "k8s.io/test-infra/prow/config"
+
+	"github.com/clarketm/pj/pkg/cli"
+	"github.com/clarketm/pj/pkg/maps"
+)
+
+// ValidateUtilityConfig checks that the decoration and cloning settings of a job do not conflict: settings used by
+// the pod utilities require a decorated job, and a job skipping cloning cannot configure how it is cloned.
+func ValidateUtilityConfig(job *cli.Job) error {
+	type setting struct {
+		field string
+		set   bool
+	}
+
+	var errorList error
+
+	if job.Decorate != nil && !*job.Decorate {
+		for _, s := range []setting{
+			{"decoration_config", job.DecorationConfig != nil},
+			{"skip_cloning", job.SkipCloning != nil},
+			{"ssh_key_secrets", len(job.SSHKeySecrets) > 0},
+			{"clone_depth", intOrDefault(job.CloneDepth, 0) != 0},
+			{"path_alias", job.PathAlias != ""},
+		} {
+			if s.set {
+				errorList = multierror.Append(errorList, fmt.Errorf("%s requires decoration, but the job sets decorate: false", s.field))
+			}
+		}
+	}
+
+	if job.SkipCloning != nil && *job.SkipCloning {
+		for _, s := range []setting{
+			{"clone_depth", intOrDefault(job.CloneDepth, 0) != 0},
+			{"extra_repos", len(job.ExtraRepos) > 0},
+		} {
+			if s.set {
+				errorList = multierror.Append(errorList, fmt.Errorf("%s conflicts with skip_cloning", s.field))
+			}
+		}
+	}
+
+	if depth := intOrDefault(job.CloneDepth, 0); depth < 0 {
+		errorList = multierror.Append(errorList, fmt.Errorf("clone_depth must not be negative: %d", depth))
+	}
+
+	return errorList
+}
+
+// createUtilityConfig returns the pod utility configuration of a job. Jobs are decorated and skip submodules unless
+// configured otherwise; the path alias defaults to the alias of the job's org.
+func createUtilityConfig(job *cli.Job) prowapi.UtilityConfig {
+	pathAlias := job.PathAlias
+	if pathAlias == "" {
+		pathAlias = maps.GetOrDefault(job.Aliases, job.Org(), "")
+	}
+
+	decorationConfig := job.DecorationConfig
+	if job.SkipCloning != nil || len(job.SSHKeySecrets) > 0 {
+		var dc prowv1.DecorationConfig
+		if decorationConfig != nil {
+			dc = *decorationConfig
+		}
+		if job.SkipCloning != nil {
+			dc.SkipCloning = job.SkipCloning
+		}
+		if len(job.SSHKeySecrets) > 0 {
+			dc.SSHKeySecrets = job.SSHKeySecrets
+		}
+		decorationConfig = &dc
+	}
+
+	return prowapi.UtilityConfig{
+		Decorate:         boolOrDefault(job.Decorate, true),
+		PathAlias:        pathAlias,
+		CloneURI:         job.CloneTemplate,
+		SkipSubmodules:   boolOrDefault(job.SkipSubmodules, true),
+		CloneDepth:       intOrDefault(job.CloneDepth, 0),
+		ExtraRefs:        createExtraRefs(job),
+		DecorationConfig: decorationConfig,
+	}
+}
+
+func boolOrDefault(b *bool, def bool) bool {
+	if b == nil {
+		return def
+	}
+	return *b
+}
+
+func intOrDefault(i *int, def int) int {
+	if i == nil {
+		return def
+	}
+	return *i
+}
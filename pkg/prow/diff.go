@@ -0,0 +1,366 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/clarketm/pj/pkg/cli"
+	"github.com/clarketm/pj/pkg/maps"
+)
+
+type ChangeType string
+
+const (
+	Added   ChangeType = "+"
+	Removed ChangeType = "-"
+	Changed ChangeType = "~"
+)
+
+// JobDiff describes how a single job differs between two job configurations.
+type JobDiff struct {
+	Type   cli.JobType
+	Repo   string
+	Name   string
+	Change ChangeType
+	Fields []FieldDiff
+}
+
+// FieldDiff describes a single field that differs between two versions of a job.
+type FieldDiff struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+func (d JobDiff) String() string {
+	if d.Repo == "" {
+		return fmt.Sprintf("%s %s %s", d.Change, d.Type, d.Name)
+	}
+	return fmt.Sprintf("%s %s %s %s", d.Change, d.Type, d.Repo, d.Name)
+}
+
+func (d FieldDiff) String() string {
+	return fmt.Sprintf("%s: %s -> %s", d.Path, formatValue(d.Old), formatValue(d.New))
+}
+
+// Entries of a generated configuration other than jobs are reported like jobs of these types. Presets are identified
+// by their labels, Tide queries and plugins by their repository and branch protection by repository and branch.
+const (
+	PresetEntry           cli.JobType = "preset"
+	TideEntry             cli.JobType = "tide"
+	BranchProtectionEntry cli.JobType = "branch-protection"
+	PluginsEntry          cli.JobType = "plugins"
+)
+
+type jobKey struct {
+	Type cli.JobType
+	Repo string
+	Name string
+}
+
+type rawJobConfig struct {
+	Presubmits  map[string][]map[string]interface{} `json:"presubmits,omitempty"`
+	Postsubmits map[string][]map[string]interface{} `json:"postsubmits,omitempty"`
+	Periodics   []map[string]interface{}            `json:"periodics,omitempty"`
+	Presets     []map[string]interface{}            `json:"presets,omitempty"`
+
+	Tide             rawTideConfig            `json:"tide,omitempty"`
+	BranchProtection rawBranchProtection      `json:"branch-protection,omitempty"`
+	Plugins          map[string][]interface{} `json:"plugins,omitempty"`
+}
+
+type rawTideConfig struct {
+	Queries []map[string]interface{} `json:"queries,omitempty"`
+}
+
+type rawBranchProtection struct {
+	Orgs map[string]struct {
+		Repos map[string]struct {
+			Branches map[string]interface{} `json:"branches,omitempty"`
+		} `json:"repos,omitempty"`
+	} `json:"orgs,omitempty"`
+}
+
+// DiffJobConfigs returns the jobs, presets and repository configuration that were added, removed or changed between
+// two marshaled job configurations. Either configuration may be empty.
+func DiffJobConfigs(oldYaml, newYaml []byte) ([]JobDiff, error) {
+	oldJobs, oldKeys, err := indexJobs(oldYaml)
+	if err != nil {
+		return nil, err
+	}
+
+	newJobs, newKeys, err := indexJobs(newYaml)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []JobDiff
+
+	for _, key := range oldKeys {
+		if _, exists := newJobs[key]; !exists {
+			diffs = append(diffs, JobDiff{Type: key.Type, Repo: key.Repo, Name: key.Name, Change: Removed})
+		}
+	}
+
+	for _, key := range newKeys {
+		oldJob, exists := oldJobs[key]
+		if !exists {
+			diffs = append(diffs, JobDiff{Type: key.Type, Repo: key.Repo, Name: key.Name, Change: Added})
+			continue
+		}
+
+		if fields := diffValues("", oldJob, newJobs[key]); len(fields) > 0 {
+			diffs = append(diffs, JobDiff{Type: key.Type, Repo: key.Repo, Name: key.Name, Change: Changed, Fields: fields})
+		}
+	}
+
+	sort.SliceStable(diffs, func(a, b int) bool {
+		if diffs[a].Type != diffs[b].Type {
+			return diffs[a].Type < diffs[b].Type
+		}
+		if diffs[a].Repo != diffs[b].Repo {
+			return diffs[a].Repo < diffs[b].Repo
+		}
+		return diffs[a].Name < diffs[b].Name
+	})
+
+	return diffs, nil
+}
+
+// DiffJobs returns the fields that differ between two jobs of the same type. Unset and empty values are
+// considered equal.
+func DiffJobs(oldJob, newJob interface{}) ([]FieldDiff, error) {
+	var a, b interface{}
+
+	for _, v := range []struct {
+		job interface{}
+		out *interface{}
+	}{{oldJob, &a}, {newJob, &b}} {
+		j, err := json.Marshal(v.job)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(j, v.out); err != nil {
+			return nil, err
+		}
+		maps.Prune(*v.out)
+	}
+
+	return diffValues("", a, b), nil
+}
+
+// indexJobs parses a marshaled job configuration and indexes its jobs and other entries by type, repository and name.
+func indexJobs(b []byte) (map[jobKey]interface{}, []jobKey, error) {
+	var raw rawJobConfig
+	var jobs = make(map[jobKey]interface{})
+	var keys []jobKey
+
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	add := func(jobType cli.JobType, repo, name string, job interface{}) {
+		key := jobKey{Type: jobType, Repo: repo, Name: name}
+
+		// Jobs sharing a name (e.g. on different branches) are distinguished by their occurrence.
+		for n := 2; ; n++ {
+			if _, exists := jobs[key]; !exists {
+				break
+			}
+			key.Name = fmt.Sprintf("%s#%d", name, n)
+		}
+
+		jobs[key] = job
+		keys = append(keys, key)
+	}
+
+	for _, repo := range SortedKeys(raw.Presubmits) {
+		for _, job := range raw.Presubmits[repo] {
+			add(cli.Presubmit, repo, jobName(job), job)
+		}
+	}
+
+	for _, repo := range SortedKeys(raw.Postsubmits) {
+		for _, job := range raw.Postsubmits[repo] {
+			add(cli.Postsubmit, repo, jobName(job), job)
+		}
+	}
+
+	for _, job := range raw.Periodics {
+		add(cli.Periodic, "", jobName(job), job)
+	}
+
+	for _, preset := range raw.Presets {
+		add(PresetEntry, "", presetSelector(preset), preset)
+	}
+
+	for _, query := range raw.Tide.Queries {
+		var repos []string
+		if r, ok := query["repos"].([]interface{}); ok {
+			for _, repo := range r {
+				repos = append(repos, fmt.Sprint(repo))
+			}
+		}
+		add(TideEntry, "", strings.Join(repos, ","), query)
+	}
+
+	for _, org := range SortedKeys(raw.BranchProtection.Orgs) {
+		repos := raw.BranchProtection.Orgs[org].Repos
+		for _, repo := range SortedKeys(repos) {
+			branches := repos[repo].Branches
+			for _, branch := range SortedKeys(branches) {
+				add(BranchProtectionEntry, org+"/"+repo, branch, branches[branch])
+			}
+		}
+	}
+
+	// Plugins are compared as a set, reporting each plugin enabled or disabled.
+	for _, repo := range SortedKeys(raw.Plugins) {
+		enabled := make(map[string]interface{})
+		for _, plugin := range raw.Plugins[repo] {
+			enabled[fmt.Sprint(plugin)] = true
+		}
+		add(PluginsEntry, "", repo, enabled)
+	}
+
+	return jobs, keys, nil
+}
+
+// diffValues recursively compares two unmarshaled values and returns the paths of the fields that differ.
+func diffValues(path string, a, b interface{}) []FieldDiff {
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make(map[string]struct{})
+		for k := range av {
+			keys[k] = struct{}{}
+		}
+		for k := range bv {
+			keys[k] = struct{}{}
+		}
+
+		var sorted []string
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		var diffs []FieldDiff
+		for _, k := range sorted {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			diffs = append(diffs, diffValues(p, av[k], bv[k])...)
+		}
+		return diffs
+
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+
+		var diffs []FieldDiff
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			var ai, bi interface{}
+			if i < len(av) {
+				ai = av[i]
+			}
+			if i < len(bv) {
+				bi = bv[i]
+			}
+			diffs = append(diffs, diffValues(fmt.Sprintf("%s[%d]", path, i), ai, bi)...)
+		}
+		return diffs
+	}
+
+	return []FieldDiff{{Path: path, Old: a, New: b}}
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<unset>"
+	}
+
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	s := strings.TrimSpace(string(b))
+	if strings.Contains(s, "\n") {
+		// Render nested values on a single line.
+		b, err := yaml.YAMLToJSON(b)
+		if err == nil {
+			s = string(b)
+		}
+	}
+	return s
+}
+
+func jobName(job map[string]interface{}) string {
+	name, _ := job["name"].(string)
+	return name
+}
+
+// presetSelector identifies a preset by the labels selecting it, e.g. `preset-service-account=true`.
+func presetSelector(preset map[string]interface{}) string {
+	labels, _ := preset["labels"].(map[string]interface{})
+
+	var selector []string
+	for k, v := range labels {
+		selector = append(selector, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(selector)
+
+	return strings.Join(selector, ",")
+}
+
+// SortedKeys returns the keys of a map with string keys in order.
+func SortedKeys(m interface{}) []string {
+	var keys []string
+
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,114 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffJobConfigsPresets(t *testing.T) {
+	oldYaml := []byte(`
+presets:
+- labels: {preset-github: "true"}
+  env: [{name: GH, value: "1"}]
+- labels: {preset-gcs: "true"}
+  env: [{name: GCS, value: "1"}]
+`)
+	newYaml := []byte(`
+presets:
+- labels: {preset-github: "true"}
+  env: [{name: GH, value: "2"}]
+- labels: {preset-docker: "true"}
+  env: [{name: DOCKER, value: "1"}]
+`)
+
+	diffs, err := DiffJobConfigs(oldYaml, newYaml)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []JobDiff{
+		{Type: PresetEntry, Name: "preset-docker=true", Change: Added},
+		{Type: PresetEntry, Name: "preset-gcs=true", Change: Removed},
+		{Type: PresetEntry, Name: "preset-github=true", Change: Changed, Fields: []FieldDiff{
+			{Path: "env[0].value", Old: "1", New: "2"},
+		}},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("expected %v, got %v", expected, diffs)
+	}
+}
+
+func TestDiffJobConfigsRepoConfig(t *testing.T) {
+	oldYaml := []byte(`
+tide:
+  queries:
+  - repos: [org/repo]
+    labels: [lgtm]
+branch-protection:
+  orgs:
+    org:
+      repos:
+        repo:
+          branches:
+            master: {protect: true, required_status_checks: {contexts: [unit]}}
+plugins:
+  org/repo: [hold, trigger]
+`)
+	newYaml := []byte(`
+tide:
+  queries:
+  - repos: [org/repo]
+    labels: [lgtm, approved]
+branch-protection:
+  orgs:
+    org:
+      repos:
+        repo:
+          branches:
+            master: {protect: true, required_status_checks: {contexts: [unit]}}
+            release-1.8: {protect: true, required_status_checks: {contexts: [unit]}}
+plugins:
+  org/repo: [lgtm, trigger]
+`)
+
+	diffs, err := DiffJobConfigs(oldYaml, newYaml)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []JobDiff{
+		{Type: BranchProtectionEntry, Repo: "org/repo", Name: "release-1.8", Change: Added},
+		{Type: PluginsEntry, Name: "org/repo", Change: Changed, Fields: []FieldDiff{
+			{Path: "hold", Old: true, New: nil},
+			{Path: "lgtm", Old: nil, New: true},
+		}},
+		{Type: TideEntry, Name: "org/repo", Change: Changed, Fields: []FieldDiff{
+			{Path: "labels[1]", Old: nil, New: "approved"},
+		}},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("expected %v, got %v", expected, diffs)
+	}
+}
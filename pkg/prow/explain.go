@@ -0,0 +1,226 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+// Layer is a configuration merged into a job, such as the job itself, its file-level defaults or one of its
+// requirements.
+type Layer struct {
+	// Origin describes where the configuration comes from.
+	Origin string
+	Job    cli.Job
+	// Inherited layers are combined with the job according to the merge strategies, rather than replaced by it.
+	Inherited bool
+}
+
+// FieldOrigin is the origin of a field of a resolved job.
+type FieldOrigin struct {
+	Path []string
+	// Origins are the layers the value comes from: a single one, unless the field combines the values of several.
+	// A field set by none of them has a default or generated value.
+	Origins []string
+	// Shadowed are the values of the field in layers of lower precedence which were not used.
+	Shadowed []ShadowedValue
+}
+
+// ShadowedValue is the value of a field in a layer which was shadowed by a layer of higher precedence.
+type ShadowedValue struct {
+	Origin string
+	Value  interface{}
+}
+
+// RequirementLayers returns the requirements of a resolved job in the order they are merged into it.
+func RequirementLayers(job cli.Job) ([]Layer, error) {
+	var layers []Layer
+
+	require, err := ExpandRequirements(job.Require, job.Requirements)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, req := range require {
+		requirement := job.Requirements[req]
+		if boolOrDefault(job.Presets, false) {
+			if requirement, err = presetRequirement(req, requirement); err != nil {
+				return nil, err
+			}
+		}
+
+		layers = append(layers, Layer{Origin: "requirement " + req, Job: requirement, Inherited: true})
+	}
+
+	return layers, nil
+}
+
+// Explain returns the origin of every field of a resolved job, given the layers it was resolved from in order of
+// precedence. Map fields are explained key by key, unless they are replaced as a whole, and lists combined from several
+// layers item by item. The requirements of the job are omitted.
+func Explain(job cli.Job, layers []Layer) ([]FieldOrigin, error) {
+	var origins []FieldOrigin
+
+	final, err := JobToMap(job)
+	if err != nil {
+		return nil, err
+	}
+	delete(final, "requirements")
+
+	var values = make([]interface{}, len(layers))
+	for i, layer := range layers {
+		if values[i], err = JobToMap(layer.Job); err != nil {
+			return nil, err
+		}
+	}
+
+	strategies := MergeStrategies(job.MergeStrategies)
+
+	var explain func(path []string, value interface{}, values []interface{})
+	explain = func(path []string, value interface{}, values []interface{}) {
+		strategy := strategies[path[0]]
+
+		if m, ok := value.(map[string]interface{}); ok && (len(path) > 1 || strategy != cli.Replace) {
+			for _, key := range sortedMapKeys(m) {
+				var children = make([]interface{}, len(values))
+				for i, v := range values {
+					if vm, ok := v.(map[string]interface{}); ok {
+						children[i] = vm[key]
+					}
+				}
+				explain(append(append([]string{}, path...), key), m[key], children)
+			}
+			return
+		}
+
+		if items, ok := value.([]interface{}); ok && len(path) == 1 && (strategy == cli.Append || strategy == cli.Prepend || strategy == cli.MergeByName) {
+			origins = append(origins, explainItems(path, items, values, layers, strategy == cli.MergeByName)...)
+			return
+		}
+
+		origin := FieldOrigin{Path: path}
+
+		for i, v := range values {
+			switch {
+			case v == nil:
+				continue
+			case len(origin.Origins) == 0:
+				origin.Origins = append(origin.Origins, layers[i].Origin)
+			default:
+				origin.Shadowed = append(origin.Shadowed, ShadowedValue{Origin: layers[i].Origin, Value: v})
+			}
+		}
+
+		origins = append(origins, origin)
+	}
+
+	for _, key := range sortedMapKeys(final) {
+		if final[key] == nil {
+			continue
+		}
+
+		var children = make([]interface{}, len(values))
+		for i, v := range values {
+			children[i] = v.(map[string]interface{})[key]
+		}
+		explain([]string{key}, final[key], children)
+	}
+
+	return origins, nil
+}
+
+// explainItems explains a list combined from several layers item by item, with the path of each item ending in its
+// index. An item comes from the first layer with an equal item, or with an item of the same name if the list is
+// merged by name, in which case the items of that name in the other layers are shadowed. The list itself comes from
+// every layer contributing an item.
+func explainItems(path []string, items []interface{}, values []interface{}, layers []Layer, byName bool) []FieldOrigin {
+	list := FieldOrigin{Path: path}
+	var origins []FieldOrigin
+	var contributed = make([]bool, len(layers))
+
+	for n, item := range items {
+		origin := FieldOrigin{Path: append(append([]string{}, path...), strconv.Itoa(n))}
+
+		from := -1
+		for i, v := range values {
+			layerItems, _ := v.([]interface{})
+			for _, layerItem := range layerItems {
+				if reflect.DeepEqual(layerItem, item) && from < 0 {
+					from = i
+				}
+			}
+		}
+
+		if byName {
+			name := itemName(item)
+			for i, v := range values {
+				layerItems, _ := v.([]interface{})
+				for _, layerItem := range layerItems {
+					switch {
+					case name == nil || itemName(layerItem) != name:
+						continue
+					case from < 0:
+						from = i
+					case i != from:
+						origin.Shadowed = append(origin.Shadowed, ShadowedValue{Origin: layers[i].Origin, Value: layerItem})
+					}
+				}
+			}
+		}
+
+		if from >= 0 {
+			origin.Origins = []string{layers[from].Origin}
+			contributed[from] = true
+		}
+		origins = append(origins, origin)
+	}
+
+	for i, layer := range layers {
+		if contributed[i] {
+			list.Origins = append(list.Origins, layer.Origin)
+		}
+	}
+
+	return append([]FieldOrigin{list}, origins...)
+}
+
+// itemName returns the name of a list item, or nil if it has none.
+func itemName(item interface{}) interface{} {
+	if m, ok := item.(map[string]interface{}); ok {
+		return m["name"]
+	}
+	return nil
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
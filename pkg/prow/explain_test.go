@@ -0,0 +1,87 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+func TestExplainCombinedLists(t *testing.T) {
+	var layers []Layer
+	for _, l := range []struct {
+		origin string
+		job    string
+	}{
+		{origin: "job", job: `{env: [{name: SHARED, value: job}]}`},
+		{origin: "global", job: `{env: [{name: GLOBAL, value: g}], args: [--global]}`},
+		{origin: "requirement", job: `{env: [{name: SHARED, value: req}, {name: GH, value: req}], args: [--req]}`},
+	} {
+		var job cli.Job
+		if err := yaml.Unmarshal([]byte(l.job), &job); err != nil {
+			t.Fatalf("unmarshal %s: %v", l.origin, err)
+		}
+		layers = append(layers, Layer{Origin: l.origin, Job: job, Inherited: l.origin != "job"})
+	}
+
+	var job cli.Job
+	if err := yaml.Unmarshal([]byte(`{
+		env: [{name: SHARED, value: job}, {name: GLOBAL, value: g}, {name: GH, value: req}],
+		args: [--global, --req],
+		merge: {args: append},
+	}`), &job); err != nil {
+		t.Fatalf("unmarshal job: %v", err)
+	}
+
+	origins, err := Explain(job, layers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var actual = make(map[string]FieldOrigin)
+	for _, o := range origins {
+		actual[strings.Join(o.Path, ".")] = o
+	}
+
+	expected := []FieldOrigin{
+		{Path: []string{"args"}, Origins: []string{"global", "requirement"}},
+		{Path: []string{"args", "0"}, Origins: []string{"global"}},
+		{Path: []string{"args", "1"}, Origins: []string{"requirement"}},
+		{Path: []string{"env"}, Origins: []string{"job", "global", "requirement"}},
+		{Path: []string{"env", "0"}, Origins: []string{"job"}, Shadowed: []ShadowedValue{
+			{Origin: "requirement", Value: map[string]interface{}{"name": "SHARED", "value": "req"}},
+		}},
+		{Path: []string{"env", "1"}, Origins: []string{"global"}},
+		{Path: []string{"env", "2"}, Origins: []string{"requirement"}},
+	}
+	for _, e := range expected {
+		if a := actual[strings.Join(e.Path, ".")]; !reflect.DeepEqual(a, e) {
+			t.Errorf("expected %+v, got %+v", e, a)
+		}
+	}
+}
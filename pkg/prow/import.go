@@ -0,0 +1,180 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"fmt"
+
+	prowapi "k8s.io/test-infra/prow/config"
+
+	"github.com/clarketm/pj/pkg/cli"
+	"github.com/clarketm/pj/pkg/maps"
+)
+
+// ImportPresubmit converts a Prow presubmit into a job, reversing CreatePresubmit.
+func ImportPresubmit(orgrepo string, ps prowapi.Presubmit) cli.Job {
+	job := importJobBase(orgrepo, ps.JobBase)
+
+	job.Type = cli.Presubmit
+	job.Branches = ps.Branches
+	job.SkipBranches = ps.SkipBranches
+	job.Regex = ps.RunIfChanged
+
+	if ps.Trigger != prowapi.DefaultTriggerFor(ps.Name) || ps.RerunCommand != prowapi.DefaultRerunCommandFor(ps.Name) {
+		job.Trigger = ps.Trigger
+		job.RerunCommand = ps.RerunCommand
+	}
+
+	switch {
+	case ps.RunIfChanged != "" && ps.AlwaysRun:
+		job.AlwaysRun = &ps.AlwaysRun
+	case ps.RunIfChanged == "" && !ps.AlwaysRun:
+		job.Modifiers = append(job.Modifiers, cli.Skipped)
+	}
+	if ps.Optional {
+		job.Modifiers = append(job.Modifiers, cli.Optional)
+	}
+	if ps.SkipReport {
+		job.Modifiers = append(job.Modifiers, cli.Hidden)
+	}
+
+	return job
+}
+
+// ImportPostsubmit converts a Prow postsubmit into a job, reversing CreatePostsubmit.
+func ImportPostsubmit(orgrepo string, ps prowapi.Postsubmit) cli.Job {
+	job := importJobBase(orgrepo, ps.JobBase)
+
+	job.Type = cli.Postsubmit
+	job.Branches = ps.Branches
+	job.SkipBranches = ps.SkipBranches
+	job.Regex = ps.RunIfChanged
+
+	if ps.SkipReport {
+		job.Modifiers = append(job.Modifiers, cli.Hidden)
+	}
+
+	return job
+}
+
+// ImportPeriodic converts a Prow periodic into a job, reversing CreatePeriodic.
+func ImportPeriodic(p prowapi.Periodic) cli.Job {
+	var orgrepo, branch string
+
+	// The first extra ref is the periodic's own repository if it is cloned like one.
+	if refs := p.ExtraRefs; len(refs) > 0 && refs[0].WorkDir && refs[0].PathAlias == p.PathAlias && refs[0].CloneURI == p.CloneURI {
+		orgrepo, branch = fmt.Sprintf("%s/%s", refs[0].Org, refs[0].Repo), refs[0].BaseRef
+		p.ExtraRefs = refs[1:]
+	}
+
+	job := importJobBase(orgrepo, p.JobBase)
+
+	if branch != "" && branch != DefaultBranch {
+		job.Branches = []string{branch}
+	}
+
+	job.Type = cli.Periodic
+	job.Interval = p.Interval
+	job.Cron = p.Cron
+
+	return job
+}
+
+func importJobBase(orgrepo string, base prowapi.JobBase) cli.Job {
+	var job cli.Job
+
+	job.OrgRepo = orgrepo
+	job.Name = base.Name
+	job.Labels = base.Labels
+	job.Annotations = base.Annotations
+	job.MaxConcurrency = base.MaxConcurrency
+	job.ClusterName = base.Cluster
+	job.ReporterConfig = base.ReporterConfig
+	job.RerunAuthConfig = base.RerunAuthConfig
+	job.DecorationConfig = base.DecorationConfig
+	job.CloneTemplate = base.CloneURI
+
+	if base.CloneDepth != 0 {
+		job.CloneDepth = &base.CloneDepth
+	}
+
+	if !base.Decorate {
+		job.Decorate = &base.Decorate
+	}
+
+	if !base.SkipSubmodules {
+		job.SkipSubmodules = &base.SkipSubmodules
+	}
+
+	if base.Namespace != nil {
+		job.Namespace = *base.Namespace
+	}
+
+	if base.Hidden {
+		job.Modifiers = append(job.Modifiers, cli.Private)
+	}
+
+	if base.PathAlias != "" {
+		job.Aliases = map[string]string{job.Org(): base.PathAlias}
+	}
+
+	for _, ref := range base.ExtraRefs {
+		repo := cli.ExtraRepo{
+			OrgRepo:  fmt.Sprintf("%s/%s", ref.Org, ref.Repo),
+			SHA:      ref.BaseSHA,
+			CloneURI: ref.CloneURI,
+			WorkDir:  ref.WorkDir,
+		}
+
+		if ref.BaseRef != DefaultBranch {
+			repo.Ref = ref.BaseRef
+		}
+
+		if ref.PathAlias != maps.GetOrDefault(job.Aliases, ref.Org, "") {
+			repo.PathAlias = ref.PathAlias
+		}
+
+		job.ExtraRepos = append(job.ExtraRepos, repo)
+	}
+
+	if base.Spec != nil {
+		job.PodSpec = *base.Spec
+		job.PodSpec.Containers = nil
+		job.PodSpec.SecurityContext = nil
+		job.PodSecurityContext = base.Spec.SecurityContext
+
+		if len(base.Spec.Containers) > 0 {
+			job.Container = base.Spec.Containers[0]
+			job.Container.Name = ""
+			job.Container.Image, job.Image = "", job.Container.Image
+			job.Container.Command, job.Command = nil, job.Container.Command
+			job.Container.SecurityContext, job.JobCore.SecurityContext = nil, job.Container.SecurityContext
+
+			if len(base.Spec.Containers) > 1 {
+				job.Containers = base.Spec.Containers[1:]
+			}
+		}
+	}
+
+	return job
+}
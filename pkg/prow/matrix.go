@@ -0,0 +1,204 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+// ExpandMatrix returns one job per combination of the job's matrix. The matrix of each expanded job holds only its
+// own combination. A job without a matrix is returned as it is, and a matrix without axes is an error since its
+// includes and excludes would otherwise be silently ignored.
+func ExpandMatrix(job cli.Job) ([]cli.Job, error) {
+	if job.Matrix == nil {
+		return []cli.Job{job}, nil
+	} else if len(job.Matrix.Axes) == 0 {
+		return nil, fmt.Errorf("matrix has no axes")
+	}
+
+	combinations := matrixCombinations(*job.Matrix)
+	if len(combinations) == 0 {
+		return nil, fmt.Errorf("matrix has no combinations")
+	}
+
+	var jobs []cli.Job
+
+	for _, c := range combinations {
+		expanded, err := job.DeepCopy()
+		if err != nil {
+			return nil, errors.Wrapf(err, "copy job: %s", job.Name)
+		}
+
+		expanded.Matrix = &cli.Matrix{Axes: make(map[string][]string)}
+		for axis, value := range c {
+			expanded.Matrix.Axes[axis] = []string{value}
+		}
+
+		jobs = append(jobs, expanded)
+	}
+
+	return jobs, nil
+}
+
+// matrixCombinations returns the combinations of the matrix axes without the excluded combinations. Axes are
+// expanded in alphabetical order, since the order of keys is not kept when job files are read, and the values of
+// each axis in the order they are listed. Each included combination extends every combination of the axes it does not
+// conflict with on an axis value, or is added as a new combination if there is none.
+func matrixCombinations(m cli.Matrix) []map[string]string {
+	var axes []string
+	for axis := range m.Axes {
+		axes = append(axes, axis)
+	}
+	sort.Strings(axes)
+
+	var combinations []map[string]string
+	if len(axes) > 0 {
+		combinations = []map[string]string{{}}
+	}
+
+	for _, axis := range axes {
+		var next []map[string]string
+		for _, c := range combinations {
+			for _, value := range m.Axes[axis] {
+				n := copyCombination(c)
+				n[axis] = value
+				next = append(next, n)
+			}
+		}
+		combinations = next
+	}
+
+	var filtered []map[string]string
+	for _, c := range combinations {
+		excluded := false
+		for _, e := range m.Exclude {
+			if matchesCombination(c, e) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			filtered = append(filtered, c)
+		}
+	}
+	combinations = filtered
+
+	// Combinations added by an include are not extended by later includes.
+	original := combinations
+
+	for _, include := range m.Include {
+		extended := false
+		for _, c := range original {
+			conflicts := false
+			for axis, value := range include {
+				if _, isAxis := m.Axes[axis]; isAxis && c[axis] != value {
+					conflicts = true
+					break
+				}
+			}
+			if conflicts {
+				continue
+			}
+
+			for axis, value := range include {
+				c[axis] = value
+			}
+			extended = true
+		}
+
+		if !extended {
+			combinations = append(combinations, copyCombination(include))
+		}
+	}
+
+	return combinations
+}
+
+func matchesCombination(c, sub map[string]string) bool {
+	for axis, value := range sub {
+		if v, exists := c[axis]; !exists || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+func copyCombination(c map[string]string) map[string]string {
+	n := make(map[string]string)
+	for axis, value := range c {
+		n[axis] = value
+	}
+	return n
+}
+
+// combination returns the matrix combination of an expanded job.
+func combination(job *cli.Job) map[string]string {
+	c := make(map[string]string)
+	if job.Matrix != nil {
+		for axis, values := range job.Matrix.Axes {
+			if len(values) == 1 {
+				c[axis] = values[0]
+			}
+		}
+	}
+	return c
+}
+
+// formatCombination formats a combination as `{axis: value, ...}` with sorted axes.
+func formatCombination(c map[string]string) string {
+	var axes []string
+	for axis := range c {
+		axes = append(axes, axis)
+	}
+	sort.Strings(axes)
+
+	var s []string
+	for _, axis := range axes {
+		s = append(s, fmt.Sprintf("%s: %s", axis, c[axis]))
+	}
+
+	return "{" + strings.Join(s, ", ") + "}"
+}
+
+// firstDifference returns the first axis on which two combinations differ.
+func firstDifference(a, b map[string]string) string {
+	var axes []string
+	for axis := range b {
+		axes = append(axes, axis)
+	}
+	sort.Strings(axes)
+
+	for _, axis := range axes {
+		if a[axis] != b[axis] {
+			return axis
+		}
+	}
+
+	return "axis"
+}
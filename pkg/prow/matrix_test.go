@@ -0,0 +1,172 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+func TestMatrixCombinations(t *testing.T) {
+	tests := []struct {
+		name     string
+		matrix   cli.Matrix
+		expected []map[string]string
+	}{
+		{
+			name:   "axes are expanded in alphabetical order",
+			matrix: cli.Matrix{Axes: map[string][]string{"k8s": {"1.17", "1.18"}, "arch": {"amd64", "arm64"}}},
+			expected: []map[string]string{
+				{"arch": "amd64", "k8s": "1.17"},
+				{"arch": "amd64", "k8s": "1.18"},
+				{"arch": "arm64", "k8s": "1.17"},
+				{"arch": "arm64", "k8s": "1.18"},
+			},
+		},
+		{
+			name: "exclude removes combinations matching every listed value",
+			matrix: cli.Matrix{
+				Axes:    map[string][]string{"k8s": {"1.17", "1.18"}, "arch": {"amd64", "arm64"}},
+				Exclude: []map[string]string{{"k8s": "1.17", "arch": "arm64"}},
+			},
+			expected: []map[string]string{
+				{"arch": "amd64", "k8s": "1.17"},
+				{"arch": "amd64", "k8s": "1.18"},
+				{"arch": "arm64", "k8s": "1.18"},
+			},
+		},
+		{
+			name: "exclude of a single axis value removes every combination with it",
+			matrix: cli.Matrix{
+				Axes:    map[string][]string{"k8s": {"1.17", "1.18"}, "arch": {"amd64", "arm64"}},
+				Exclude: []map[string]string{{"arch": "arm64"}},
+			},
+			expected: []map[string]string{
+				{"arch": "amd64", "k8s": "1.17"},
+				{"arch": "amd64", "k8s": "1.18"},
+			},
+		},
+		{
+			name: "include extends every combination it does not conflict with",
+			matrix: cli.Matrix{
+				Axes:    map[string][]string{"k8s": {"1.17", "1.18"}, "arch": {"amd64", "arm64"}},
+				Include: []map[string]string{{"arch": "arm64", "runner": "qemu"}},
+			},
+			expected: []map[string]string{
+				{"arch": "amd64", "k8s": "1.17"},
+				{"arch": "amd64", "k8s": "1.18"},
+				{"arch": "arm64", "k8s": "1.17", "runner": "qemu"},
+				{"arch": "arm64", "k8s": "1.18", "runner": "qemu"},
+			},
+		},
+		{
+			name: "include conflicting with every combination is added",
+			matrix: cli.Matrix{
+				Axes:    map[string][]string{"k8s": {"1.17", "1.18"}, "arch": {"amd64"}},
+				Include: []map[string]string{{"k8s": "1.19", "arch": "amd64"}},
+			},
+			expected: []map[string]string{
+				{"arch": "amd64", "k8s": "1.17"},
+				{"arch": "amd64", "k8s": "1.18"},
+				{"arch": "amd64", "k8s": "1.19"},
+			},
+		},
+		{
+			name: "include is applied after exclude",
+			matrix: cli.Matrix{
+				Axes:    map[string][]string{"arch": {"amd64", "arm64"}},
+				Exclude: []map[string]string{{"arch": "arm64"}},
+				Include: []map[string]string{{"arch": "arm64"}},
+			},
+			expected: []map[string]string{
+				{"arch": "amd64"},
+				{"arch": "arm64"},
+			},
+		},
+		{
+			name:   "include without axes adds combinations",
+			matrix: cli.Matrix{Include: []map[string]string{{"os": "linux"}, {"os": "windows"}}},
+			expected: []map[string]string{
+				{"os": "linux"},
+				{"os": "windows"},
+			},
+		},
+		{
+			name: "excluding every combination leaves none",
+			matrix: cli.Matrix{
+				Axes:    map[string][]string{"arch": {"amd64"}},
+				Exclude: []map[string]string{{"arch": "amd64"}},
+			},
+			expected: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := matrixCombinations(tc.matrix)
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestExpandMatrix(t *testing.T) {
+	var job cli.Job
+	job.Name = "e2e"
+	job.Matrix = &cli.Matrix{
+		Axes:    map[string][]string{"arch": {"amd64", "arm64"}},
+		Exclude: []map[string]string{{"arch": "amd64"}},
+		Include: []map[string]string{{"arch": "arm64", "runner": "qemu"}},
+	}
+
+	jobs, err := ExpandMatrix(job)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string][]string{"arch": {"arm64"}, "runner": {"qemu"}}
+	if len(jobs) != 1 || !reflect.DeepEqual(jobs[0].Matrix.Axes, expected) {
+		t.Fatalf("expected one job with matrix %v, got %v", expected, jobs)
+	}
+
+	job.Matrix.Exclude = []map[string]string{{}}
+	job.Matrix.Include = nil
+	if _, err := ExpandMatrix(job); err == nil {
+		t.Errorf("expected an error for a matrix without combinations")
+	}
+
+	for _, m := range []cli.Matrix{
+		{},
+		{Include: []map[string]string{{"arch": "arm64"}}},
+		{Exclude: []map[string]string{{"arch": "arm64"}}},
+	} {
+		m := m
+		job.Matrix = &m
+		if _, err := ExpandMatrix(job); err == nil {
+			t.Errorf("expected an error for a matrix without axes: %+v", m)
+		}
+	}
+}
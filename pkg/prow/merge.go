@@ -0,0 +1,331 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/imdario/mergo"
+	"github.com/pkg/errors"
+
+	"github.com/clarketm/pj/pkg/cli"
+	"github.com/clarketm/pj/pkg/source"
+	strutil "github.com/clarketm/pj/pkg/strings"
+)
+
+// DefaultMergeStrategies are the merge strategies of fields which are not configured otherwise. Lists of named
+// items are merged by name so that every requirement contributes its items; all other lists are replaced and all
+// maps are merged.
+var DefaultMergeStrategies = map[string]cli.MergeStrategy{
+	"env":            cli.MergeByName,
+	"volumes":        cli.MergeByName,
+	"volumeMounts":   cli.MergeByName,
+	"containers":     cli.MergeByName,
+	"initContainers": cli.MergeByName,
+}
+
+var jobFields = source.JSONFields(reflect.TypeOf(cli.Job{}))
+
+// MergeStrategies returns the merge strategy of every configured field, with later configurations taking
+// precedence over earlier ones and all of them over DefaultMergeStrategies.
+func MergeStrategies(configs ...map[string]cli.MergeStrategy) map[string]cli.MergeStrategy {
+	strategies := make(map[string]cli.MergeStrategy)
+
+	for _, c := range append([]map[string]cli.MergeStrategy{DefaultMergeStrategies}, configs...) {
+		for field, strategy := range c {
+			strategies[field] = strategy
+		}
+	}
+
+	return strategies
+}
+
+// ValidateMergeStrategies checks that each strategy exists and applies to the kind of its field: `append`,
+// `prepend` and `replace` to lists, `merge-by-name` to lists of named items, and `merge` and `replace` to maps.
+func ValidateMergeStrategies(strategies map[string]cli.MergeStrategy) error {
+	var errorList error
+
+	var names []string
+	for name := range jobFields {
+		names = append(names, name)
+	}
+
+	var fields []string
+	for field := range strategies {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		strategy := strategies[field]
+
+		t, exists := jobFields[field]
+		if !exists {
+			msg := fmt.Sprintf("merge: unknown field: %s", field)
+			if closest := strutil.Closest(field, names); closest != "" {
+				msg += fmt.Sprintf(" (did you mean %q?)", closest)
+			}
+			errorList = multierror.Append(errorList, errors.New(msg))
+			continue
+		}
+
+		var allowed []cli.MergeStrategy
+		switch t.Kind() {
+		case reflect.Slice:
+			allowed = []cli.MergeStrategy{cli.Append, cli.Prepend, cli.Replace}
+			if hasName(t.Elem()) {
+				allowed = append(allowed, cli.MergeByName)
+			}
+		case reflect.Map:
+			allowed = []cli.MergeStrategy{cli.Merge, cli.Replace}
+		default:
+			errorList = multierror.Append(errorList, fmt.Errorf("merge: field %s is not a list or map", field))
+			continue
+		}
+
+		if !hasStrategy(allowed, strategy) {
+			var s []string
+			for _, a := range allowed {
+				s = append(s, string(a))
+			}
+			errorList = multierror.Append(errorList, fmt.Errorf("merge: invalid strategy for %s: %s (allowed: %s)", field, strategy, strings.Join(s, ", ")))
+		}
+	}
+
+	return errorList
+}
+
+// MergeJob merges src into dst. Fields set on dst take precedence over those of src, except for list and map
+// fields which are combined according to their merge strategy:
+//
+//	append         src items are appended after the dst items.
+//	prepend        src items are inserted before the dst items.
+//	merge-by-name  like append, skipping src items named like a dst item.
+//	merge          map entries are merged key by key, dst entries taking precedence.
+//	replace        the src value is only used if dst has none.
+func MergeJob(dst *cli.Job, src cli.Job, strategies map[string]cli.MergeStrategy) error {
+	dstMap, err := JobToMap(*dst)
+	if err != nil {
+		return err
+	}
+
+	srcMap, err := JobToMap(src)
+	if err != nil {
+		return err
+	}
+
+	combined := make(map[string]interface{})
+
+	for field, strategy := range strategies {
+		srcValue, exists := srcMap[field]
+		if !exists || srcValue == nil {
+			continue
+		}
+
+		dstValue, exists := dstMap[field]
+
+		switch strategy {
+		case cli.Merge:
+			continue
+		case cli.Replace:
+			if exists {
+				delete(srcMap, field)
+			}
+			continue
+		}
+
+		dstList, _ := dstValue.([]interface{})
+		srcList, ok := srcValue.([]interface{})
+		if !ok {
+			return fmt.Errorf("merge: invalid strategy for %s: %s", field, strategy)
+		}
+
+		switch strategy {
+		case cli.Append:
+			combined[field] = append(append([]interface{}{}, dstList...), srcList...)
+		case cli.Prepend:
+			combined[field] = append(append([]interface{}{}, srcList...), dstList...)
+		case cli.MergeByName:
+			combined[field] = mergeByName(dstList, srcList)
+		default:
+			return fmt.Errorf("merge: unknown strategy for %s: %s", field, strategy)
+		}
+
+		delete(srcMap, field)
+	}
+
+	keepZero(dstMap, srcMap)
+
+	var rest cli.Job
+	if err := JobFromMap(srcMap, &rest); err != nil {
+		return err
+	}
+
+	if err := mergo.Merge(dst, rest); err != nil {
+		return err
+	}
+
+	if len(combined) == 0 {
+		return nil
+	}
+
+	// Rebuild the job rather than decoding into it, since decoding a list reuses its backing array which may be
+	// shared with the job's defaults or requirements.
+	if dstMap, err = JobToMap(*dst); err != nil {
+		return err
+	}
+
+	for field, value := range combined {
+		dstMap[field] = value
+	}
+
+	var job cli.Job
+	if err := JobFromMap(dstMap, &job); err != nil {
+		return err
+	}
+
+	*dst = job
+	return nil
+}
+
+// MergeFields merges the fields of src which are not set on dst into dst, like mergo.Merge, except that booleans set
+// to false and numbers set to zero on dst are kept rather than treated as unset.
+func MergeFields(dst *cli.Job, src cli.Job) error {
+	dstMap, err := JobToMap(*dst)
+	if err != nil {
+		return err
+	}
+
+	srcMap, err := JobToMap(src)
+	if err != nil {
+		return err
+	}
+
+	keepZero(dstMap, srcMap)
+
+	var rest cli.Job
+	if err := JobFromMap(srcMap, &rest); err != nil {
+		return err
+	}
+
+	return mergo.Merge(dst, rest)
+}
+
+// keepZero removes the fields of src, at any depth, which are set to false or zero in dst, since mergo would
+// otherwise override them.
+func keepZero(dst, src map[string]interface{}) {
+	for field, srcValue := range src {
+		switch dstValue := dst[field].(type) {
+		case bool:
+			if !dstValue {
+				delete(src, field)
+			}
+		case float64:
+			if dstValue == 0 {
+				delete(src, field)
+			}
+		case map[string]interface{}:
+			if srcMap, ok := srcValue.(map[string]interface{}); ok {
+				keepZero(dstValue, srcMap)
+			}
+		}
+	}
+}
+
+// mergeByName appends the src items to the dst items, skipping src items named like an item already present.
+func mergeByName(dst, src []interface{}) []interface{} {
+	out := append([]interface{}{}, dst...)
+
+	names := make(map[interface{}]bool)
+	for _, item := range dst {
+		if m, ok := item.(map[string]interface{}); ok {
+			names[m["name"]] = true
+		}
+	}
+
+	for _, item := range src {
+		if m, ok := item.(map[string]interface{}); ok && names[m["name"]] {
+			continue
+		}
+		out = append(out, item)
+	}
+
+	return out
+}
+
+// hasName reports whether items of a list type are identified by a name field.
+func hasName(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+
+	_, exists := source.JSONFields(t)["name"]
+	return exists
+}
+
+func hasStrategy(strategies []cli.MergeStrategy, strategy cli.MergeStrategy) bool {
+	for _, s := range strategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// JobToMap converts a job into its unmarshaled representation, keyed by json field name.
+func JobToMap(job cli.Job) (map[string]interface{}, error) {
+	var m map[string]interface{}
+
+	b, err := json.Marshal(job)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal job")
+	}
+
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal job")
+	}
+
+	return m, nil
+}
+
+// JobFromMap converts the unmarshaled representation of a job back into a job.
+func JobFromMap(m map[string]interface{}, job *cli.Job) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrapf(err, "marshal job")
+	}
+
+	if err := json.Unmarshal(b, job); err != nil {
+		return errors.Wrapf(err, "unmarshal job")
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/clarketm/pj/pkg/cli"
+	pjlog "github.com/clarketm/pj/pkg/log"
+)
+
+func TestMergeKeepsZero(t *testing.T) {
+	layers := []struct {
+		name  string
+		merge func(job *cli.Job, inherited cli.Job) error
+	}{
+		{
+			name: "file-level defaults",
+			merge: func(job *cli.Job, inherited cli.Job) error {
+				return ResolveJob(pjlog.Discard(), job, inherited, cli.Job{})
+			},
+		},
+		{
+			name: "global configuration",
+			merge: func(job *cli.Job, inherited cli.Job) error {
+				return ResolveJob(pjlog.Discard(), job, cli.Job{}, inherited)
+			},
+		},
+		{
+			name: "requirement",
+			merge: func(job *cli.Job, inherited cli.Job) error {
+				job.Require = []string{"inherited"}
+				job.Requirements = map[string]cli.Job{"inherited": inherited}
+				return ResolveJob(pjlog.Discard(), job, cli.Job{}, cli.Job{})
+			},
+		},
+		{
+			name: "extended job",
+			merge: func(job *cli.Job, inherited cli.Job) error {
+				return ExtendJob(job, inherited)
+			},
+		},
+	}
+
+	// decorate: false conflicts with clone settings, so it is checked on its own.
+	tests := []struct {
+		job       string
+		inherited string
+		fields    []string
+	}{
+		{
+			job:       `{decorate: false}`,
+			inherited: `{decorate: true}`,
+			fields:    []string{"decorate"},
+		},
+		{
+			job:       `{skip_cloning: false, skip_submodules: false, always_run: false, run_before_merge: false}`,
+			inherited: `{decorate: true, skip_cloning: true, skip_submodules: true, always_run: true, run_before_merge: true}`,
+			fields:    []string{"skip_cloning", "skip_submodules", "always_run", "run_before_merge"},
+		},
+		{
+			job:       `{clone_depth: 0}`,
+			inherited: `{clone_depth: 1}`,
+			fields:    []string{"clone_depth"},
+		},
+	}
+
+	for _, layer := range layers {
+		for _, tc := range tests {
+			t.Run(layer.name, func(t *testing.T) {
+				var job, inherited cli.Job
+				if err := yaml.Unmarshal([]byte(tc.job), &job); err != nil {
+					t.Fatalf("unmarshal job: %v", err)
+				}
+				if err := yaml.Unmarshal([]byte(tc.inherited), &inherited); err != nil {
+					t.Fatalf("unmarshal inherited job: %v", err)
+				}
+
+				if err := layer.merge(&job, inherited); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				values, err := JobToMap(job)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				for _, field := range tc.fields {
+					if value := values[field]; value != false && value != float64(0) {
+						t.Errorf("expected %s to be kept false or zero, got %v", field, value)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestMergeInheritsUnset(t *testing.T) {
+	var job, parent cli.Job
+	if err := yaml.Unmarshal([]byte(`{decorate: true, skip_cloning: true}`), &parent); err != nil {
+		t.Fatalf("unmarshal inherited job: %v", err)
+	}
+
+	if err := ResolveJob(pjlog.Discard(), &job, parent, cli.Job{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if job.Decorate == nil || !*job.Decorate || job.SkipCloning == nil || !*job.SkipCloning {
+		t.Errorf("expected decorate and skip_cloning to be inherited, got %v and %v", job.Decorate, job.SkipCloning)
+	}
+}
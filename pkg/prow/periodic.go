@@ -0,0 +1,300 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"gopkg.in/robfig/cron.v2"
+	prowv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	prowapi "k8s.io/test-infra/prow/config"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+// ValidateSchedule checks that a periodic has either a valid cron expression or a valid interval.
+func ValidateSchedule(job *cli.Job) error {
+	var errorList error
+
+	switch {
+	case job.Cron != "" && job.Interval != "":
+		errorList = multierror.Append(errorList, fmt.Errorf("cron and interval cannot both be set"))
+	case job.Cron == "" && job.Interval == "":
+		errorList = multierror.Append(errorList, fmt.Errorf("periodic requires cron or interval"))
+	}
+
+	if job.Cron != "" {
+		if err := parseCron(job.Cron); err != nil {
+			errorList = multierror.Append(errorList, fmt.Errorf("invalid cron %q: %v", job.Cron, err))
+		}
+	}
+
+	if job.Interval != "" {
+		if d, err := time.ParseDuration(job.Interval); err != nil {
+			errorList = multierror.Append(errorList, fmt.Errorf("invalid interval %q: %v", job.Interval, err))
+		} else if d <= 0 {
+			errorList = multierror.Append(errorList, fmt.Errorf("invalid interval %q: must be positive", job.Interval))
+		}
+	}
+
+	if job.CronTZ != "" && job.Cron == "" {
+		errorList = multierror.Append(errorList, fmt.Errorf("cron_tz requires cron"))
+	}
+
+	return errorList
+}
+
+// cronLog serializes the calls to the cron library while it has the standard logger silenced.
+var cronLog sync.Mutex
+
+// parseCron checks a cron expression with the cron library Prow uses. The library logs its errors through the
+// standard logger before returning them, so the logger is silenced while it parses. A step of zero, which the library
+// loops on forever, is rejected first.
+func parseCron(expr string) (err error) {
+	for _, field := range strings.Fields(expr) {
+		for _, r := range strings.Split(field, ",") {
+			if i := strings.Index(r, "/"); i >= 0 {
+				if step, err := strconv.Atoi(r[i+1:]); err == nil && step == 0 {
+					return fmt.Errorf("step must be positive: %s", r)
+				}
+			}
+		}
+	}
+
+	cronLog.Lock()
+	defer cronLog.Unlock()
+
+	w := log.Writer()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(w)
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%v", recovered)
+		}
+	}()
+
+	_, err = cron.Parse(expr)
+	return err
+}
+
+// convertCronTZ converts the cron expression of a periodic written in its `cron_tz` timezone to UTC.
+func convertCronTZ(job *cli.Job) error {
+	if job.CronTZ == "" || job.Cron == "" {
+		return nil
+	}
+
+	utc, err := CronToUTC(job.Cron, job.CronTZ)
+	if err != nil {
+		return fmt.Errorf("cron_tz: %v", err)
+	}
+
+	job.Cron, job.CronTZ = utc, ""
+	return nil
+}
+
+// CronToUTC converts a five field cron expression in a named timezone to UTC. Prow runs periodics in UTC and cron
+// has no notion of daylight saving time, so the standard time offset the timezone had in cronTZYear is used all year
+// round. The minute and hour fields must be numbers, ranges or lists of them, and a schedule moving to another day in
+// UTC may only restrict the day of the week.
+func CronToUTC(expr, tz string) (string, error) {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return "", fmt.Errorf("expected a cron expression with 5 fields: %s", expr)
+	}
+	minute, hour, dom, month, dow := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	offset := standardOffset(loc)
+	if offset == 0 {
+		return expr, nil
+	}
+
+	if hour == "*" && offset%60 == 0 && dom == "*" && dow == "*" {
+		return expr, nil
+	}
+
+	hours, err := cronValues(hour, 0, 23)
+	if err != nil {
+		return "", fmt.Errorf("hour: %v", err)
+	}
+
+	var minutes = []int{0}
+	if offset%60 != 0 {
+		if minutes, err = cronValues(minute, 0, 59); err != nil {
+			return "", fmt.Errorf("minute: %v", err)
+		}
+		if len(minutes) != 1 {
+			return "", fmt.Errorf("minute: must be a single value in a timezone offset by a fraction of an hour")
+		}
+	}
+
+	var utcHours []int
+	var utcMinute, dayShift int
+
+	for i, h := range hours {
+		total := h*60 + minutes[0] - offset
+		shift := floorDiv(total, 24*60)
+		total -= shift * 24 * 60
+
+		if i > 0 && shift != dayShift && (dom != "*" || dow != "*") {
+			return "", fmt.Errorf("hours %s fall on different days in UTC", hour)
+		}
+
+		utcHours = append(utcHours, total/60)
+		utcMinute, dayShift = total%60, shift
+	}
+	sort.Ints(utcHours)
+
+	if offset%60 != 0 {
+		minute = strconv.Itoa(utcMinute)
+	}
+
+	if dayShift != 0 && dom != "*" {
+		return "", fmt.Errorf("day of month %s moves to another day in UTC", dom)
+	}
+
+	if dayShift != 0 && dow != "*" {
+		days, err := cronValues(dow, 0, 7)
+		if err != nil {
+			return "", fmt.Errorf("day of week: %v", err)
+		}
+		for i, d := range days {
+			days[i] = ((d+dayShift)%7 + 7) % 7
+		}
+		dow = joinInts(days)
+	}
+
+	return strings.Join([]string{minute, joinInts(utcHours), dom, month, dow}, " "), nil
+}
+
+// cronTZYear is the year whose timezone rules convert `cron_tz` schedules, so that the generated jobs do not depend
+// on the date they are generated on.
+const cronTZYear = 2020
+
+// standardOffset returns the offset of a timezone from UTC in minutes outside of daylight saving time, which is the
+// smaller of its offsets in January and July of cronTZYear.
+func standardOffset(loc *time.Location) int {
+	_, jan := time.Date(cronTZYear, time.January, 1, 0, 0, 0, 0, loc).Zone()
+	_, jul := time.Date(cronTZYear, time.July, 1, 0, 0, 0, 0, loc).Zone()
+
+	if jul < jan {
+		jan = jul
+	}
+	return jan / 60
+}
+
+// cronValues expands a cron field made of numbers and ranges separated by commas.
+func cronValues(field string, min, max int) ([]int, error) {
+	var values []int
+
+	for _, part := range strings.Split(field, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+
+		lo, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("unsupported value %q: only numbers and ranges can be converted", part)
+		}
+
+		hi := lo
+		if len(bounds) == 2 {
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("unsupported value %q: only numbers and ranges can be converted", part)
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v++ {
+			values = append(values, v)
+		}
+	}
+
+	return values, nil
+}
+
+func joinInts(values []int) string {
+	var s []string
+	for _, v := range values {
+		s = append(s, strconv.Itoa(v))
+	}
+	return strings.Join(s, ",")
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// primaryRef returns the ref of a periodic's own repository, cloned with its path alias and clone URI like the
+// repository of other jobs. It is the working directory unless one of the extra repositories is, and is omitted if
+// the job skips cloning, has no repository or lists it in its extra repositories.
+func primaryRef(job *cli.Job, utility prowapi.UtilityConfig) (prowv1.Refs, bool) {
+	if job.SkipCloning != nil && *job.SkipCloning {
+		return prowv1.Refs{}, false
+	}
+	if !strings.Contains(job.OrgRepo, "/") {
+		return prowv1.Refs{}, false
+	}
+
+	ref := prowv1.Refs{
+		Org:       job.Org(),
+		Repo:      job.Repo(),
+		BaseRef:   DefaultBranch,
+		PathAlias: utility.PathAlias,
+		CloneURI:  utility.CloneURI,
+		WorkDir:   true,
+	}
+
+	if len(job.Branches) > 0 {
+		ref.BaseRef = job.Branches[0]
+	}
+
+	for _, repo := range job.ExtraRepos {
+		if repo.OrgRepo == job.OrgRepo {
+			return prowv1.Refs{}, false
+		}
+		if repo.WorkDir {
+			ref.WorkDir = false
+		}
+	}
+
+	return ref, true
+}
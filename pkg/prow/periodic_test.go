@@ -0,0 +1,81 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr  string
+		valid bool
+	}{
+		{expr: "0 3 * * *", valid: true},
+		{expr: "0 0 3 * * ?", valid: true},
+		{expr: "*/15 9-17 * jan-jun mon,wed,fri", valid: true},
+		{expr: "0 3/2 1,15 * *", valid: true},
+		{expr: "TZ=America/New_York 0 3 * * *", valid: true},
+		{expr: "@daily", valid: true},
+		{expr: "@every 1h30m", valid: true},
+		{expr: "0 3 * *"},
+		{expr: "0 24 * * *"},
+		{expr: "0 3 0 * *"},
+		{expr: "0 5-3 * * *"},
+		{expr: "0 1-2-3 * * *"},
+		{expr: "*/0 * * * *"},
+		{expr: "0 3 * * someday"},
+		{expr: "TZ=Nowhere/City 0 3 * * *"},
+		{expr: "@every day"},
+		{expr: "@sometimes"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			if err := parseCron(tc.expr); (err == nil) != tc.valid {
+				t.Errorf("expected valid: %v, got error: %v", tc.valid, err)
+			}
+		})
+	}
+}
+
+func TestParseCronLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	if err := parseCron("0 24 * * *"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if buf.Len() > 0 {
+		t.Errorf("expected no log output, got: %s", buf.String())
+	}
+
+	log.Print("after")
+	if buf.Len() == 0 {
+		t.Error("expected the log output to be restored")
+	}
+}
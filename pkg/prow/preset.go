@@ -0,0 +1,198 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	prowapi "k8s.io/test-infra/prow/config"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+// PresetLabel returns the label which selects the preset generated for a requirement.
+func PresetLabel(requirement string) string {
+	return "preset-" + requirement
+}
+
+// presetRequirement returns the part of a requirement merged into a job which applies the requirement as a preset:
+// its env, volumes and volume mounts are left to the preset, selected by the preset label. Requirements without any
+// of them, or with templates in them, are merged into the job as they are.
+func presetRequirement(name string, requirement cli.Job) (cli.Job, error) {
+	if !hasPreset(requirement) {
+		return requirement, nil
+	}
+
+	requirement, err := requirement.DeepCopy()
+	if err != nil {
+		return requirement, errors.Wrapf(err, "copy requirement: %s", name)
+	}
+
+	requirement.Env = nil
+	requirement.Volumes = nil
+	requirement.VolumeMounts = nil
+
+	if requirement.Labels == nil {
+		requirement.Labels = make(map[string]string)
+	}
+	requirement.Labels[PresetLabel(name)] = "true"
+
+	return requirement, nil
+}
+
+// hasPreset reports whether a requirement can be applied as a preset.
+func hasPreset(requirement cli.Job) bool {
+	if len(requirement.Env) == 0 && len(requirement.Volumes) == 0 && len(requirement.VolumeMounts) == 0 {
+		return false
+	}
+
+	b, err := json.Marshal(createPreset("", requirement))
+	return err == nil && !strings.Contains(string(b), "{{")
+}
+
+func createPreset(name string, requirement cli.Job) prowapi.Preset {
+	return prowapi.Preset{
+		Labels:       map[string]string{PresetLabel(name): "true"},
+		Env:          requirement.Env,
+		Volumes:      requirement.Volumes,
+		VolumeMounts: requirement.VolumeMounts,
+	}
+}
+
+// appliedPresets returns the requirements of a resolved job which were applied as presets, in the order Prow applies
+// them.
+func appliedPresets(job *cli.Job) []string {
+	var presets []string
+
+	if !boolOrDefault(job.Presets, false) {
+		return nil
+	}
+
+	require, err := ExpandRequirements(job.Require, job.Requirements)
+	if err != nil {
+		return nil
+	}
+
+	for _, req := range require {
+		if job.Labels[PresetLabel(req)] == "true" && hasPreset(job.Requirements[req]) {
+			presets = append(presets, req)
+		}
+	}
+
+	return presets
+}
+
+// CreatePresets returns the Prow presets of the requirements a job applies as presets.
+func CreatePresets(job *cli.Job) []prowapi.Preset {
+	var presets []prowapi.Preset
+
+	for _, req := range appliedPresets(job) {
+		presets = append(presets, createPreset(req, job.Requirements[req]))
+	}
+
+	return presets
+}
+
+// ValidatePresets checks that the presets of a job do not add env variables, volumes or volume mounts the job already
+// has, which Prow rejects when loading the jobs.
+func ValidatePresets(job *cli.Job) error {
+	var errorList error
+
+	env, volumes, mounts := sets.String{}, sets.String{}, sets.String{}
+	for _, c := range append([]corev1.Container{job.Container}, job.Containers...) {
+		for _, e := range c.Env {
+			env.Insert(e.Name)
+		}
+		for _, m := range c.VolumeMounts {
+			mounts.Insert(m.Name)
+		}
+	}
+	for _, v := range job.Volumes {
+		volumes.Insert(v.Name)
+	}
+
+	for _, req := range appliedPresets(job) {
+		requirement := job.Requirements[req]
+
+		for _, e := range requirement.Env {
+			if env.Has(e.Name) {
+				errorList = multierror.Append(errorList, fmt.Errorf("preset %s: env %s is already set", PresetLabel(req), e.Name))
+			}
+			env.Insert(e.Name)
+		}
+		for _, v := range requirement.Volumes {
+			if volumes.Has(v.Name) {
+				errorList = multierror.Append(errorList, fmt.Errorf("preset %s: volume %s is already defined", PresetLabel(req), v.Name))
+			}
+			volumes.Insert(v.Name)
+		}
+		for _, m := range requirement.VolumeMounts {
+			if mounts.Has(m.Name) {
+				errorList = multierror.Append(errorList, fmt.Errorf("preset %s: volume mount %s is already defined", PresetLabel(req), m.Name))
+			}
+			mounts.Insert(m.Name)
+		}
+	}
+
+	return errorList
+}
+
+// AddPresets adds presets to the job configuration. A preset already added must be identical.
+func (o *ProwJobConfig) AddPresets(presets []prowapi.Preset) error {
+	var errorList error
+
+	for _, preset := range presets {
+		i := o.presetIndex(preset)
+		switch {
+		case i < 0:
+			o.Presets = append(o.Presets, preset)
+		case !reflect.DeepEqual(o.Presets[i], preset):
+			errorList = multierror.Append(errorList, fmt.Errorf("preset %s differs from a preset of the same requirement defined for another job", presetName(preset)))
+		}
+	}
+
+	return errorList
+}
+
+func (o *ProwJobConfig) presetIndex(preset prowapi.Preset) int {
+	for i, p := range o.Presets {
+		if reflect.DeepEqual(p.Labels, preset.Labels) {
+			return i
+		}
+	}
+	return -1
+}
+
+func presetName(preset prowapi.Preset) string {
+	for label := range preset.Labels {
+		return label
+	}
+	return ""
+}
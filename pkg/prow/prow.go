@@ -23,12 +23,12 @@
 package prow
 
 import (
-	"bytes"
 	"fmt"
-	"html/template"
+	"sort"
 	"strings"
 
-	"github.com/Masterminds/sprig"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	prowv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	prowapi "k8s.io/test-infra/prow/config"
@@ -37,34 +37,134 @@ import (
 
 	"github.com/clarketm/pj/pkg/cli"
 	"github.com/clarketm/pj/pkg/maps"
+	strutil "github.com/clarketm/pj/pkg/strings"
 )
 
-func ResolveTemplate(tmplStr string, job *cli.Job) string {
-	if tmplStr == "" {
-		return tmplStr
+// ResolveJob merges file-level defaults, global configuration and the job's requirements into a job, combining list
+// and map fields according to the merge strategies configured by each of them. With presets enabled, the env, volumes
+// and volume mounts of requirements are left to Prow presets. The decoration settings of the resolved job are
+// validated. Each layer merged and each requirement resolved is logged at debug level.
+func ResolveJob(log *logrus.Entry, job *cli.Job, defaults cli.Job, global cli.Job) error {
+	strategies := MergeStrategies(global.MergeStrategies, defaults.MergeStrategies, job.MergeStrategies)
+	if err := ValidateMergeStrategies(strategies); err != nil {
+		return err
 	}
 
-	var b bytes.Buffer
+	for _, l := range []struct {
+		layer string
+		job   cli.Job
+	}{{"defaults", defaults}, {"global", global}} {
+		log.WithField("layer", l.layer).Debug("Merging layer.")
+		if err := MergeJob(job, l.job, strategies); err != nil {
+			return errors.Wrapf(err, "merge defaults")
+		}
+	}
 
-	tmpl, err := template.New(job.Name).Funcs(sprig.FuncMap()).Parse(tmplStr)
+	require, err := ExpandRequirements(job.Require, job.Requirements)
 	if err != nil {
-		fmt.Println(err)
-		return tmplStr
+		return err
 	}
 
-	err = tmpl.Execute(&b, struct {
-		Org  string
-		Repo string
-	}{
-		Org:  job.Org(),
-		Repo: job.Repo(),
-	})
+	presets := boolOrDefault(job.Presets, false)
+
+	for _, req := range require {
+		requirement := job.Requirements[req]
+		log.WithFields(logrus.Fields{"requirement": req, "preset": presets && hasPreset(requirement)}).Debug("Resolving requirement.")
+
+		if presets {
+			if requirement, err = presetRequirement(req, requirement); err != nil {
+				return err
+			}
+		}
+
+		if err := MergeJob(job, requirement, strategies); err != nil {
+			return errors.Wrapf(err, "merge requirement: %s", req)
+		}
+	}
+
+	return ValidateUtilityConfig(job)
+}
+
+// ExtendJob merges the job it extends into a job. Fields set on the job take precedence: scalars and lists replace
+// the parent's value as a whole, while maps and nested objects are merged key by key. The parent's name is never
+// inherited.
+func ExtendJob(job *cli.Job, parent cli.Job) error {
+	parent, err := parent.DeepCopy()
 	if err != nil {
-		fmt.Println(err)
-		return tmplStr
+		return errors.Wrapf(err, "copy job: %s", job.Extends)
 	}
 
-	return b.String()
+	parent.Name = ""
+	parent.Extends = ""
+
+	if err := MergeFields(job, parent); err != nil {
+		return errors.Wrapf(err, "merge job: %s", job.Extends)
+	}
+
+	return nil
+}
+
+// ExpandRequirements returns the requirements in the order they are merged, with each requirement followed by
+// the requirements it requires itself. Requirements reachable more than once are included once, at their first
+// occurrence.
+func ExpandRequirements(require []string, requirements map[string]cli.Job) ([]string, error) {
+	var expanded []string
+	var seen = sets.String{}
+
+	var expand func(req string, path []string) error
+	expand = func(req string, path []string) error {
+		for i, p := range path {
+			if p == req {
+				return fmt.Errorf("requirement cycle: %s", strings.Join(append(path[i:], req), " -> "))
+			}
+		}
+
+		requirement, exists := requirements[req]
+		if !exists && len(path) > 0 {
+			return errors.Wrapf(unknownRequirement(req, requirements), "requirement %s", path[len(path)-1])
+		} else if !exists {
+			return unknownRequirement(req, requirements)
+		}
+
+		if !seen.Has(req) {
+			seen.Insert(req)
+			expanded = append(expanded, req)
+		}
+
+		for _, r := range requirement.Require {
+			if err := expand(r, append(path, req)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, req := range require {
+		if err := expand(req, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return expanded, nil
+}
+
+func unknownRequirement(name string, requirements map[string]cli.Job) error {
+	var available []string
+	for req := range requirements {
+		available = append(available, req)
+	}
+	sort.Strings(available)
+
+	msg := fmt.Sprintf("unknown requirement: %s", name)
+	if closest := strutil.Closest(name, available); closest != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", closest)
+	}
+
+	if len(available) == 0 {
+		return fmt.Errorf("%s (no requirements are defined)", msg)
+	}
+	return fmt.Errorf("%s (available: %s)", msg, strings.Join(available, ", "))
 }
 
 func SetDefaults(job *cli.Job) {
@@ -85,25 +185,109 @@ func SetDefaults(job *cli.Job) {
 	}
 }
 
-func CreatePresubmit(job *cli.Job) prowapi.Presubmit {
+// ExpandJob returns the jobs generated by a job with defaults set: one job per matrix combination and job type, with
+// every string field executed as a template. Jobs generated by a matrix must have distinct names.
+func ExpandJob(job cli.Job) ([]cli.Job, error) {
+	combinations, err := ExpandMatrix(job)
+	if err != nil {
+		return nil, err
+	}
+
+	type jobKey struct {
+		Type cli.JobType
+		Name string
+	}
+
+	var matrix = job.Matrix != nil
+	var jobs []cli.Job
+	var names = make(map[jobKey]map[string]string)
+
+	for _, c := range combinations {
+		for _, jobType := range c.Types {
+			expanded, err := c.DeepCopy()
+			if err != nil {
+				return nil, errors.Wrapf(err, "copy job: %s", c.Name)
+			}
+
+			expanded.Type = ""
+			expanded.Types = []cli.JobType{jobType}
+
+			err = TemplateJob(&expanded)
+			if err == nil && jobType == cli.Periodic {
+				err = convertCronTZ(&expanded)
+			}
+			if err == nil {
+				err = validateExpandedJob(&expanded)
+			}
+
+			if err != nil && matrix {
+				return nil, errors.Wrapf(err, "matrix %s", formatCombination(combination(&c)))
+			} else if err != nil {
+				return nil, err
+			}
+
+			if matrix {
+				key := jobKey{Type: jobType, Name: expanded.Name}
+				if other, exists := names[key]; exists {
+					return nil, fmt.Errorf("matrix job name %s is not unique: generated by %s and %s (reference the matrix in the name, e.g. {{.Matrix.%s}})",
+						expanded.Name, formatCombination(other), formatCombination(combination(&c)), firstDifference(other, combination(&c)))
+				}
+				names[key] = combination(&c)
+			}
+
+			jobs = append(jobs, expanded)
+		}
+	}
+
+	return jobs, nil
+}
+
+// validateExpandedJob checks the fields of a templated job which may depend on templates.
+func validateExpandedJob(job *cli.Job) error {
+	for i, repo := range job.ExtraRepos {
+		if err := repo.Validate(); err != nil {
+			return errors.Wrapf(err, "extra_repos[%d]", i)
+		}
+	}
+
+	if err := ValidatePresets(job); err != nil {
+		return err
+	}
+
+	switch job.Types[0] {
+	case cli.Presubmit:
+		return ValidateTriggers(job)
+	case cli.Periodic:
+		return ValidateSchedule(job)
+	}
+
+	return nil
+}
+
+func CreatePresubmit(job *cli.Job) Presubmit {
 	mods := jobModifiers(job.Modifiers)
+	trigger, rerunCommand := triggers(job)
 
-	return prowapi.Presubmit{
-		JobBase:      createJobBase(job, mods),
-		AlwaysRun:    !mods.Has(string(cli.Skipped)),
-		Optional:     mods.Has(string(cli.Optional)),
-		Trigger:      job.Trigger,
-		RerunCommand: job.RerunCommand,
-		Brancher: prowapi.Brancher{
-			SkipBranches: job.SkipBranches,
-			Branches:     job.Branches,
-		},
-		RegexpChangeMatcher: prowapi.RegexpChangeMatcher{
-			RunIfChanged: job.Regex,
-		},
-		Reporter: prowapi.Reporter{
-			SkipReport: mods.Has(string(cli.Hidden)),
+	return Presubmit{
+		Presubmit: prowapi.Presubmit{
+			JobBase:      createJobBase(job, mods),
+			AlwaysRun:    alwaysRun(job, mods),
+			Optional:     mods.Has(string(cli.Optional)),
+			Trigger:      trigger,
+			RerunCommand: rerunCommand,
+			Brancher: prowapi.Brancher{
+				SkipBranches: job.SkipBranches,
+				Branches:     job.Branches,
+			},
+			RegexpChangeMatcher: prowapi.RegexpChangeMatcher{
+				RunIfChanged: job.Regex,
+			},
+			Reporter: prowapi.Reporter{
+				SkipReport: mods.Has(string(cli.Hidden)),
+			},
 		},
+		SkipIfOnlyChanged: job.SkipIfOnlyChanged,
+		RunBeforeMerge:    boolOrDefault(job.RunBeforeMerge, false),
 	}
 }
 
@@ -127,9 +311,14 @@ func CreatePostsubmit(job *cli.Job) prowapi.Postsubmit {
 
 func CreatePeriodic(job *cli.Job) prowapi.Periodic {
 	mods := jobModifiers(job.Modifiers)
+	base := createJobBase(job, mods)
+
+	if ref, ok := primaryRef(job, base.UtilityConfig); ok {
+		base.ExtraRefs = append([]prowv1.Refs{ref}, base.ExtraRefs...)
+	}
 
 	return prowapi.Periodic{
-		JobBase:  createJobBase(job, mods),
+		JobBase:  base,
 		Interval: job.Interval,
 		Cron:     job.Cron,
 	}
@@ -137,60 +326,59 @@ func CreatePeriodic(job *cli.Job) prowapi.Periodic {
 
 func createJobBase(job *cli.Job, mods sets.String) prowapi.JobBase {
 	return prowapi.JobBase{
-		Name:           job.Name,
-		Labels:         job.Labels,
-		MaxConcurrency: job.MaxConcurrency,
-		Cluster:        job.ClusterName,
-		Namespace:      &job.Namespace,
-		Spec: &corev1.PodSpec{
-			Containers: []corev1.Container{
-				{
-					Image:           job.Image,
-					Command:         job.Command,
-					Env:             job.Env,
-					Resources:       job.JobCore.Resources,
-					VolumeMounts:    job.VolumeMounts,
-					SecurityContext: job.Container.SecurityContext,
-				},
-			},
-			Volumes:      job.Volumes,
-			NodeSelector: job.NodeSelector,
-		},
+		Name:            job.Name,
+		Labels:          job.Labels,
+		MaxConcurrency:  job.MaxConcurrency,
+		Cluster:         job.ClusterName,
+		Namespace:       &job.Namespace,
+		Spec:            createPodSpec(job),
 		Annotations:     job.Annotations,
 		Hidden:          mods.Has(string(cli.Private)),
 		ReporterConfig:  job.ReporterConfig,
 		RerunAuthConfig: job.RerunAuthConfig,
-		UtilityConfig: prowapi.UtilityConfig{
-			Decorate:         true, // TODO
-			PathAlias:        maps.GetOrDefault(job.Aliases, job.Org(), ""),
-			CloneURI:         ResolveTemplate(job.CloneTemplate, job),
-			SkipSubmodules:   true, // TODO
-			CloneDepth:       0,    // TODO
-			ExtraRefs:        createExtraRefs(job.ExtraRepos),
-			DecorationConfig: job.DecorationConfig,
-		},
+		UtilityConfig:   createUtilityConfig(job),
 	}
 }
 
-func createExtraRefs(refs []string) []prowv1.Refs {
-	var extraRefs []prowv1.Refs
+// createPodSpec returns the pod spec of a job. Its first container is built from the container fields of the job and
+// is followed by the additional `containers` of the job, if any.
+func createPodSpec(job *cli.Job) *corev1.PodSpec {
+	container := job.Container
+	container.Image = job.Image
+	container.Command = job.Command
+	container.SecurityContext = job.JobCore.SecurityContext
 
-	for _, ref := range refs {
-		var branch = "master" // TODO constant
+	spec := job.PodSpec
+	spec.SecurityContext = job.PodSecurityContext
+	spec.Containers = append([]corev1.Container{container}, job.Containers...)
 
-		orgrepobranch := strings.Split(ref, "@")
-		if len(orgrepobranch) > 1 {
-			branch = orgrepobranch[1]
+	return &spec
+}
+
+// createExtraRefs returns the refs of the extra repositories of a job. The ref of an extra repository defaults to the
+// default branch and its path alias to the alias of its org, as for the job's own repository.
+func createExtraRefs(job *cli.Job) []prowv1.Refs {
+	var extraRefs []prowv1.Refs
+
+	for _, repo := range job.ExtraRepos {
+		var ref = repo.Ref
+		if ref == "" {
+			ref = DefaultBranch
 		}
 
-		orgrepo := strings.Split(orgrepobranch[0], "/")
-		org := orgrepo[0]
-		repo := orgrepo[1]
+		var pathAlias = repo.PathAlias
+		if pathAlias == "" {
+			pathAlias = maps.GetOrDefault(job.Aliases, repo.Org(), "")
+		}
 
 		extraRefs = append(extraRefs, prowv1.Refs{
-			Org:     org,
-			Repo:    repo,
-			BaseRef: branch,
+			Org:       repo.Org(),
+			Repo:      repo.Repo(),
+			BaseRef:   ref,
+			BaseSHA:   repo.SHA,
+			PathAlias: pathAlias,
+			CloneURI:  repo.CloneURI,
+			WorkDir:   repo.WorkDir,
 		})
 	}
 
@@ -0,0 +1,251 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+// TestCreatePodSpec checks that every container and pod spec field of a job is passed through to its pod spec: the
+// container fields to the first container and the pod spec fields to the pod spec.
+func TestCreatePodSpec(t *testing.T) {
+	runAsUser := int64(1000)
+	privileged := true
+
+	containerFields := []struct {
+		field string
+		value string
+	}{
+		{field: "args", value: `[-j, "4"]`},
+		{field: "workingDir", value: `/src`},
+		{field: "ports", value: `[{containerPort: 8080, protocol: TCP}]`},
+		{field: "envFrom", value: `[{configMapRef: {name: env}}, {prefix: SECRET_, secretRef: {name: token}}]`},
+		{field: "env", value: `[{name: GOFLAGS, value: -mod=vendor}]`},
+		{field: "resources", value: `{limits: {memory: 1Gi}, requests: {cpu: "1"}}`},
+		{field: "volumeMounts", value: `[{name: cache, mountPath: /cache, readOnly: true}]`},
+		{field: "volumeDevices", value: `[{name: disk, devicePath: /dev/xvda}]`},
+		{field: "livenessProbe", value: `{exec: {command: ["true"]}, periodSeconds: 10}`},
+		{field: "readinessProbe", value: `{httpGet: {path: /healthz, port: 8080}}`},
+		{field: "startupProbe", value: `{tcpSocket: {port: 8080}, failureThreshold: 30}`},
+		{field: "lifecycle", value: `{preStop: {exec: {command: [sleep, "5"]}}}`},
+		{field: "terminationMessagePath", value: `/tmp/termination-log`},
+		{field: "terminationMessagePolicy", value: `FallbackToLogsOnError`},
+		{field: "imagePullPolicy", value: `Always`},
+		{field: "securityContext", value: `{privileged: true, runAsUser: 1000}`},
+		{field: "stdin", value: `true`},
+		{field: "stdinOnce", value: `true`},
+		{field: "tty", value: `true`},
+	}
+
+	podFields := []struct {
+		field string
+		value string
+	}{
+		{field: "volumes", value: `[{name: cache, emptyDir: {}}]`},
+		{field: "initContainers", value: `[{name: fetch, image: busybox, command: [wget, https://example.com/data], resources: {}}]`},
+		{field: "ephemeralContainers", value: `[{name: debug, image: busybox, resources: {}}]`},
+		{field: "restartPolicy", value: `Never`},
+		{field: "terminationGracePeriodSeconds", value: `30`},
+		{field: "activeDeadlineSeconds", value: `3600`},
+		{field: "dnsPolicy", value: `ClusterFirst`},
+		{field: "nodeSelector", value: `{testing: test-pool}`},
+		{field: "serviceAccountName", value: `prow`},
+		{field: "serviceAccount", value: `prow`},
+		{field: "automountServiceAccountToken", value: `false`},
+		{field: "nodeName", value: `node-1`},
+		{field: "hostNetwork", value: `true`},
+		{field: "hostPID", value: `true`},
+		{field: "hostIPC", value: `true`},
+		{field: "shareProcessNamespace", value: `true`},
+		{field: "podSecurityContext", value: `{runAsUser: 1000, fsGroup: 2000}`},
+		{field: "imagePullSecrets", value: `[{name: registry}]`},
+		{field: "hostname", value: `builder`},
+		{field: "subdomain", value: `builds`},
+		{field: "affinity", value: `{nodeAffinity: {requiredDuringSchedulingIgnoredDuringExecution: {nodeSelectorTerms: [{matchExpressions: [{key: pool, operator: In, values: [build]}]}]}}}`},
+		{field: "schedulerName", value: `custom`},
+		{field: "tolerations", value: `[{key: dedicated, operator: Equal, value: test, effect: NoSchedule}]`},
+		{field: "hostAliases", value: `[{ip: 127.0.0.1, hostnames: [registry.local]}]`},
+		{field: "priorityClassName", value: `high`},
+		{field: "priority", value: `1000`},
+		{field: "dnsConfig", value: `{nameservers: [8.8.8.8]}`},
+		{field: "readinessGates", value: `[{conditionType: Ready}]`},
+		{field: "runtimeClassName", value: `gvisor`},
+		{field: "enableServiceLinks", value: `false`},
+		{field: "preemptionPolicy", value: `Never`},
+		{field: "overhead", value: `{cpu: 250m}`},
+		{field: "topologySpreadConstraints", value: `[{maxSkew: 1, topologyKey: zone, whenUnsatisfiable: DoNotSchedule, labelSelector: {matchLabels: {app: test}}}]`},
+	}
+
+	// Fields of the job rather than of its container, and the containers following it, are checked separately.
+	covered := map[string]bool{"name": true, "image": true, "command": true, "containers": true}
+	for _, f := range containerFields {
+		covered[f.field] = true
+	}
+	for _, f := range podFields {
+		covered[f.field] = true
+	}
+	covered["securityContext"] = covered["podSecurityContext"]
+
+	for _, fields := range []interface{}{corev1.Container{}, corev1.PodSpec{}} {
+		for _, field := range jsonFields(reflect.TypeOf(fields)) {
+			if !covered[field] {
+				t.Errorf("%T field %s is not covered", fields, field)
+			}
+		}
+	}
+
+	for _, f := range containerFields {
+		t.Run(f.field, func(t *testing.T) {
+			spec := podSpecMap(t, "image: golang:1.14\n"+f.field+": "+f.value)
+			container := spec["containers"].([]interface{})[0].(map[string]interface{})
+			checkField(t, container[f.field], f.value)
+		})
+	}
+
+	for _, f := range podFields {
+		t.Run(f.field, func(t *testing.T) {
+			spec := podSpecMap(t, "image: golang:1.14\n"+f.field+": "+f.value)
+			field := f.field
+			if field == "podSecurityContext" {
+				field = "securityContext"
+			}
+			checkField(t, spec[field], f.value)
+		})
+	}
+
+	tests := []struct {
+		name     string
+		job      string
+		expected corev1.PodSpec
+	}{
+		{
+			name: "job fields make up the first container",
+			job: `
+name: unit
+image: golang:1.14
+command: [make, test]
+`,
+			expected: corev1.PodSpec{
+				Containers: []corev1.Container{{Image: "golang:1.14", Command: []string{"make", "test"}}},
+			},
+		},
+		{
+			name: "additional containers follow the first container",
+			job: `
+image: golang:1.14
+command: [make, e2e]
+args: [-v]
+containers:
+- name: redis
+  image: redis:6
+  ports: [{containerPort: 6379}]
+- name: proxy
+  image: envoy:1.14
+  args: [--config, /etc/envoy.yaml]
+`,
+			expected: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Image: "golang:1.14", Command: []string{"make", "e2e"}, Args: []string{"-v"}},
+					{Name: "redis", Image: "redis:6", Ports: []corev1.ContainerPort{{ContainerPort: 6379}}},
+					{Name: "proxy", Image: "envoy:1.14", Args: []string{"--config", "/etc/envoy.yaml"}},
+				},
+			},
+		},
+		{
+			name: "container and pod security contexts are kept apart",
+			job: `
+image: golang:1.14
+securityContext: {privileged: true}
+podSecurityContext: {runAsUser: 1000}
+`,
+			expected: corev1.PodSpec{
+				Containers:      []corev1.Container{{Image: "golang:1.14", SecurityContext: &corev1.SecurityContext{Privileged: &privileged}}},
+				SecurityContext: &corev1.PodSecurityContext{RunAsUser: &runAsUser},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var job cli.Job
+			if err := yaml.Unmarshal([]byte(tc.job), &job); err != nil {
+				t.Fatalf("unmarshal job: %v", err)
+			}
+
+			actual := createPodSpec(&job)
+			if !reflect.DeepEqual(*actual, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, *actual)
+			}
+		})
+	}
+}
+
+// podSpecMap returns the unmarshaled representation of the pod spec of a job.
+func podSpecMap(t *testing.T, job string) map[string]interface{} {
+	var j cli.Job
+	if err := yaml.Unmarshal([]byte(job), &j); err != nil {
+		t.Fatalf("unmarshal job: %v", err)
+	}
+
+	b, err := json.Marshal(createPodSpec(&j))
+	if err != nil {
+		t.Fatalf("marshal pod spec: %v", err)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("unmarshal pod spec: %v", err)
+	}
+	return m
+}
+
+// checkField checks that a field of a pod spec has the value written in the job.
+func checkField(t *testing.T, actual interface{}, value string) {
+	var expected interface{}
+	if err := yaml.Unmarshal([]byte(value), &expected); err != nil {
+		t.Fatalf("unmarshal value: %v", err)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+// jsonFields returns the json names of the fields of a struct.
+func jsonFields(t reflect.Type) []string {
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
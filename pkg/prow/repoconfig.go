@@ -0,0 +1,177 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	prowapi "k8s.io/test-infra/prow/config"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+// TideConfig is the part of Prow's Tide configuration generated for repositories.
+type TideConfig struct {
+	Queries []prowapi.TideQuery `json:"queries,omitempty"`
+}
+
+// AddRepoConfig adds the Tide query of a job's repository and the contexts its presubmit requires to the Prow
+// configuration. Jobs of the same repository must define the same Tide query.
+func (o *ProwJobConfig) AddRepoConfig(job *cli.Job) error {
+	if !strings.Contains(job.OrgRepo, "/") {
+		return fmt.Errorf("prow_config_tmpl requires a repo")
+	}
+
+	if job.Tide != nil {
+		query := *job.Tide
+		query.Repos = []string{job.OrgRepo}
+
+		if existing, exists := o.Tide[job.OrgRepo]; !exists {
+			o.Tide[job.OrgRepo] = query
+		} else if !reflect.DeepEqual(existing, query) {
+			return fmt.Errorf("tide query differs from the tide query of another job of %s", job.OrgRepo)
+		}
+	}
+
+	if !requiresContext(job) {
+		return nil
+	}
+
+	if o.RequiredContexts[job.OrgRepo] == nil {
+		o.RequiredContexts[job.OrgRepo] = make(map[string]sets.String)
+	}
+
+	for _, branch := range job.Branches {
+		// Branch protection applies to branches by name, not to the regular expressions Prow matches branches with.
+		// A `.` is taken literally, as it is in most branch names.
+		if strings.ContainsAny(branch, `^$*+?()[]{}|\`) {
+			continue
+		}
+
+		if o.RequiredContexts[job.OrgRepo][branch] == nil {
+			o.RequiredContexts[job.OrgRepo][branch] = sets.String{}
+		}
+		o.RequiredContexts[job.OrgRepo][branch].Insert(job.Name)
+	}
+
+	return nil
+}
+
+// AddPlugins enables the plugins of a job for its repository in the plugin configuration.
+func (o *ProwJobConfig) AddPlugins(job *cli.Job) error {
+	if len(job.Plugins) == 0 {
+		return nil
+	} else if !strings.Contains(job.OrgRepo, "/") {
+		return fmt.Errorf("plugin_config_tmpl requires a repo")
+	}
+
+	if o.Plugins[job.OrgRepo] == nil {
+		o.Plugins[job.OrgRepo] = sets.String{}
+	}
+	o.Plugins[job.OrgRepo].Insert(job.Plugins...)
+
+	return nil
+}
+
+// requiresContext reports whether a job is a presubmit whose status must pass for pull requests to merge: it is not
+// optional, skipped or hidden.
+func requiresContext(job *cli.Job) bool {
+	mods := jobModifiers(job.Modifiers)
+	if mods.HasAny(string(cli.Optional), string(cli.Skipped), string(cli.Hidden)) {
+		return false
+	}
+
+	for _, jobType := range job.Types {
+		if jobType == cli.Presubmit {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tideConfig returns the Tide queries, ordered by repository.
+func (o *ProwJobConfig) tideConfig() *TideConfig {
+	if len(o.Tide) == 0 {
+		return nil
+	}
+
+	var tide TideConfig
+	for _, orgrepo := range SortedKeys(o.Tide) {
+		tide.Queries = append(tide.Queries, o.Tide[orgrepo])
+	}
+
+	return &tide
+}
+
+// branchProtection returns the branch protection requiring the contexts of the presubmits on each branch.
+func (o *ProwJobConfig) branchProtection() *prowapi.BranchProtection {
+	if len(o.RequiredContexts) == 0 {
+		return nil
+	}
+
+	protect := true
+	bp := prowapi.BranchProtection{Orgs: make(map[string]prowapi.Org)}
+
+	for orgrepo, branches := range o.RequiredContexts {
+		org, repo := splitOrgRepo(orgrepo)
+
+		if _, exists := bp.Orgs[org]; !exists {
+			bp.Orgs[org] = prowapi.Org{Repos: make(map[string]prowapi.Repo)}
+		}
+
+		r := prowapi.Repo{Branches: make(map[string]prowapi.Branch)}
+		for branch, contexts := range branches {
+			r.Branches[branch] = prowapi.Branch{Policy: prowapi.Policy{
+				Protect:              &protect,
+				RequiredStatusChecks: &prowapi.ContextPolicy{Contexts: contexts.List()},
+			}}
+		}
+
+		bp.Orgs[org].Repos[repo] = r
+	}
+
+	return &bp
+}
+
+// pluginConfig returns the plugins enabled for each repository.
+func (o *ProwJobConfig) pluginConfig() map[string][]string {
+	if len(o.Plugins) == 0 {
+		return nil
+	}
+
+	plugins := make(map[string][]string)
+	for orgrepo, p := range o.Plugins {
+		plugins[orgrepo] = p.List()
+	}
+
+	return plugins
+}
+
+func splitOrgRepo(orgrepo string) (string, string) {
+	parts := strings.SplitN(orgrepo, "/", 2)
+	return parts[0], parts[1]
+}
@@ -0,0 +1,289 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"github.com/pkg/errors"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+// TemplateData is the data available to job templates.
+type TemplateData struct {
+	Name     string
+	Org      string
+	Repo     string
+	Branch   string
+	Branches []string
+	Type     cli.JobType
+	Matrix   map[string]string
+	Vars     map[string]string
+}
+
+// NewTemplateData returns the template data of a job. The branch is the first branch of the job and the type its
+// first type.
+func NewTemplateData(job *cli.Job) TemplateData {
+	data := TemplateData{
+		Name:     job.Name,
+		Branch:   job.Branch,
+		Branches: job.Branches,
+		Type:     job.Type,
+		Vars:     job.Vars,
+	}
+
+	if strings.Contains(job.OrgRepo, "/") {
+		data.Org, data.Repo = job.Org(), job.Repo()
+	}
+
+	if len(job.Branches) > 0 {
+		data.Branch = job.Branches[0]
+	}
+
+	if len(job.Types) > 0 {
+		data.Type = job.Types[0]
+	}
+
+	if job.Matrix != nil {
+		data.Matrix = combination(job)
+	}
+
+	return data
+}
+
+// ExecuteTemplate executes a sprig template with the given data. Strings without template actions are returned as
+// they are. Referencing a matrix value or variable which is not defined is an error.
+func ExecuteTemplate(name, tmplStr string, data TemplateData) (string, error) {
+	if !strings.Contains(tmplStr, "{{") {
+		return tmplStr, nil
+	}
+
+	var b bytes.Buffer
+
+	tmpl, err := template.New(name).Funcs(sprig.TxtFuncMap()).Option("missingkey=error").Parse(tmplStr)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// TemplateJob executes every string field of a job as a template, including list items and map keys and values.
+// The name is executed first so that the other fields see the resolved name. Requirements, matrix values and
+// variables are data rather than templates and are left as they are. Extra repositories are cloned with the job's
+// clone template executed for their own org and repo.
+func TemplateJob(job *cli.Job) error {
+	data := NewTemplateData(job)
+
+	name, err := ExecuteTemplate(job.Name, job.Name, data)
+	if err != nil {
+		return errors.Wrapf(err, "name")
+	}
+	job.Name, data.Name = name, name
+
+	cloneTemplate := job.CloneTemplate
+
+	err = walkTemplateFields(job, func(path, s string) (string, error) {
+		out, err := ExecuteTemplate(job.Name, s, data)
+		if err != nil {
+			return "", errors.Wrapf(err, "%s", path)
+		}
+		return out, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return templateExtraRepos(job, cloneTemplate, data)
+}
+
+// templateExtraRepos sets the clone URI of the extra repositories without one by executing the job's clone template
+// with the org and repo of each extra repository. A clone template without template actions is specific to the job's
+// own repository and is not applied.
+func templateExtraRepos(job *cli.Job, cloneTemplate string, data TemplateData) error {
+	if !strings.Contains(cloneTemplate, "{{") {
+		return nil
+	}
+
+	for i := range job.ExtraRepos {
+		repo := &job.ExtraRepos[i]
+		if repo.CloneURI != "" || repo.Validate() != nil {
+			continue
+		}
+
+		repoData := data
+		repoData.Org, repoData.Repo = repo.Org(), repo.Repo()
+
+		uri, err := ExecuteTemplate(job.Name, cloneTemplate, repoData)
+		if err != nil {
+			return errors.Wrapf(err, "extra_repos[%d].clone_uri", i)
+		}
+		repo.CloneURI = uri
+	}
+
+	return nil
+}
+
+// EscapeTemplates returns a copy of a job with the template actions in every string field escaped, so that
+// TemplateJob reproduces the original strings.
+func EscapeTemplates(job cli.Job) (cli.Job, error) {
+	escaped, err := job.DeepCopy()
+	if err != nil {
+		return job, errors.Wrapf(err, "copy job: %s", job.Name)
+	}
+
+	err = walkTemplateFields(&escaped, func(path, s string) (string, error) {
+		return strings.Replace(s, "{{", `{{"{{"}}`, -1), nil
+	})
+
+	return escaped, err
+}
+
+// walkTemplateFields calls fn for every templated string field of a job, replacing the field by its result.
+func walkTemplateFields(job *cli.Job, fn func(path, s string) (string, error)) error {
+	requirements, matrix, vars := job.Requirements, job.Matrix, job.Vars
+	job.Requirements, job.Matrix, job.Vars = nil, nil, nil
+
+	defer func() {
+		job.Requirements, job.Matrix, job.Vars = requirements, matrix, vars
+	}()
+
+	return walkStrings(reflect.ValueOf(job).Elem(), "", fn)
+}
+
+// walkStrings calls fn for every settable string reachable from v, replacing the string by its result.
+func walkStrings(v reflect.Value, path string, fn func(path, s string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return walkStrings(v.Elem(), path, fn)
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+
+			p := path
+			if !f.Anonymous || name != "" {
+				if name == "" {
+					name = f.Name
+				}
+				p = joinFieldPath(path, name)
+			}
+
+			if err := walkStrings(v.Field(i), p, fn); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface()) })
+
+		// Every entry is rewritten before the map is changed, so that a key is never replaced by another key.
+		type entry struct{ key, value reflect.Value }
+		entries := make([]entry, len(keys))
+		origins := make(map[interface{}]reflect.Value)
+
+		for i, k := range keys {
+			p := joinFieldPath(path, fmt.Sprint(k.Interface()))
+
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			if err := walkStrings(e, p, fn); err != nil {
+				return err
+			}
+
+			key := k
+			if k.Kind() == reflect.String {
+				s, err := fn(p, k.String())
+				if err != nil {
+					return err
+				}
+				key = reflect.ValueOf(s).Convert(k.Type())
+			}
+
+			if other, exists := origins[key.Interface()]; exists {
+				return fmt.Errorf("%s: keys %v and %v are both templated to %v", path, other.Interface(), k.Interface(), key.Interface())
+			}
+			origins[key.Interface()] = k
+			entries[i] = entry{key: key, value: e}
+		}
+
+		for _, k := range keys {
+			v.SetMapIndex(k, reflect.Value{})
+		}
+		for _, e := range entries {
+			v.SetMapIndex(e.key, e.value)
+		}
+
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+
+		s, err := fn(path, v.String())
+		if err != nil {
+			return err
+		}
+		if s != v.String() {
+			v.SetString(s)
+		}
+	}
+
+	return nil
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
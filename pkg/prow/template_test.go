@@ -0,0 +1,81 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+func TestTemplateJobMapKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		job      string
+		expected map[string]string
+		err      bool
+	}{
+		{
+			name:     "keys are templated",
+			job:      `{name: unit, branches: [master], labels: {"{{.Name}}": "{{.Branch}}", app: test}}`,
+			expected: map[string]string{"unit": "master", "app": "test"},
+		},
+		{
+			name: "key templated to an existing key",
+			job:  `{name: unit, labels: {"{{.Name}}": a, unit: b}}`,
+			err:  true,
+		},
+		{
+			name: "keys templated to the same key",
+			job:  `{name: unit, branches: [unit], labels: {"{{.Name}}": a, "{{.Branch}}": b}}`,
+			err:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var job cli.Job
+			if err := yaml.Unmarshal([]byte(tc.job), &job); err != nil {
+				t.Fatalf("unmarshal job: %v", err)
+			}
+
+			err := TemplateJob(&job)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected an error, got labels %v", job.Labels)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(job.Labels, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, job.Labels)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+	"k8s.io/apimachinery/pkg/util/sets"
+	prowapi "k8s.io/test-infra/prow/config"
+
+	"github.com/clarketm/pj/pkg/cli"
+)
+
+// ValidateTriggers checks that the triggers of a presubmit do not conflict: a job always runs or runs depending on
+// the changed files, but not both, and a custom trigger comes with the rerun command matching it.
+func ValidateTriggers(job *cli.Job) error {
+	var errorList error
+
+	always := job.AlwaysRun != nil && *job.AlwaysRun
+
+	if always {
+		if job.Regex != "" {
+			errorList = multierror.Append(errorList, fmt.Errorf("always_run conflicts with regex"))
+		}
+		if jobModifiers(job.Modifiers).Has(string(cli.Skipped)) {
+			errorList = multierror.Append(errorList, fmt.Errorf("always_run conflicts with the %s modifier", cli.Skipped))
+		}
+	}
+
+	for _, err := range validateSkipIfOnlyChanged(job.SkipIfOnlyChanged, job.Regex, always) {
+		errorList = multierror.Append(errorList, err)
+	}
+
+	if (job.Trigger == "") != (job.RerunCommand == "") {
+		errorList = multierror.Append(errorList, fmt.Errorf("trigger and rerun_command must be set together"))
+	}
+
+	return errorList
+}
+
+// ValidatePresubmits checks the triggers of generated presubmits which the Prow version pj validates against does
+// not know about, and so does not validate itself. Errors are returned as a JobError.
+func ValidatePresubmits(presubmits map[string][]Presubmit) error {
+	var errorList error
+
+	var repos []string
+	for repo := range presubmits {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+
+	for _, repo := range repos {
+		for _, job := range presubmits[repo] {
+			for _, err := range job.validateTriggers() {
+				errorList = multierror.Append(errorList, JobError{Repo: repo, Job: job.Name, Err: err})
+			}
+		}
+	}
+
+	return errorList
+}
+
+// validateTriggers checks the triggers of a generated presubmit.
+func (p Presubmit) validateTriggers() []error {
+	var errs []error
+	for _, err := range validateSkipIfOnlyChanged(p.SkipIfOnlyChanged, p.RunIfChanged, p.AlwaysRun) {
+		errs = append(errs, fmt.Errorf("invalid job %s: %v", p.Name, err))
+	}
+	return errs
+}
+
+// validateSkipIfOnlyChanged checks that skip_if_only_changed is a valid regex and is not combined with regex, written
+// as run_if_changed, or always_run, as newer Prow versions require.
+func validateSkipIfOnlyChanged(skipIfOnlyChanged, regex string, always bool) []error {
+	if skipIfOnlyChanged == "" {
+		return nil
+	}
+
+	var errs []error
+
+	if _, err := regexp.Compile(skipIfOnlyChanged); err != nil {
+		errs = append(errs, fmt.Errorf("skip_if_only_changed: %v", err))
+	}
+	if regex != "" {
+		errs = append(errs, fmt.Errorf("regex conflicts with skip_if_only_changed"))
+	}
+	if always {
+		errs = append(errs, fmt.Errorf("always_run conflicts with skip_if_only_changed"))
+	}
+
+	return errs
+}
+
+// alwaysRun reports whether a presubmit runs on every change. Unless configured otherwise, jobs run on every change
+// when they are not skipped and run regardless of the changed files.
+func alwaysRun(job *cli.Job, mods sets.String) bool {
+	if job.AlwaysRun != nil {
+		return *job.AlwaysRun
+	}
+	return !mods.Has(string(cli.Skipped)) && job.Regex == "" && job.SkipIfOnlyChanged == ""
+}
+
+// triggers returns the trigger and rerun command of a presubmit, defaulting to Prow's `/test <name>` command.
+func triggers(job *cli.Job) (trigger, rerunCommand string) {
+	if job.Trigger == "" && job.RerunCommand == "" {
+		return prowapi.DefaultTriggerFor(job.Name), prowapi.DefaultRerunCommandFor(job.Name)
+	}
+	return job.Trigger, job.RerunCommand
+}
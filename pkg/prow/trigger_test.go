@@ -0,0 +1,94 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	prowapi "k8s.io/test-infra/prow/config"
+)
+
+func TestValidatePresubmits(t *testing.T) {
+	tests := []struct {
+		name      string
+		presubmit Presubmit
+		errors    int
+	}{
+		{
+			name:      "skip_if_only_changed",
+			presubmit: Presubmit{SkipIfOnlyChanged: `^docs/`},
+		},
+		{
+			name:      "invalid regex",
+			presubmit: Presubmit{SkipIfOnlyChanged: `^docs/(`},
+			errors:    1,
+		},
+		{
+			name: "run_if_changed",
+			presubmit: Presubmit{
+				Presubmit: prowapi.Presubmit{
+					RegexpChangeMatcher: prowapi.RegexpChangeMatcher{RunIfChanged: `^src/`},
+				},
+				SkipIfOnlyChanged: `^docs/`,
+			},
+			errors: 1,
+		},
+		{
+			name: "always_run",
+			presubmit: Presubmit{
+				Presubmit:         prowapi.Presubmit{AlwaysRun: true},
+				SkipIfOnlyChanged: `^docs/`,
+			},
+			errors: 1,
+		},
+		{
+			name: "always_run without skip_if_only_changed",
+			presubmit: Presubmit{
+				Presubmit:      prowapi.Presubmit{AlwaysRun: true},
+				RunBeforeMerge: true,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.presubmit.Name = "unit"
+
+			err := ValidatePresubmits(map[string][]Presubmit{"org/repo": {tc.presubmit}})
+
+			var errs []error
+			if merr, ok := err.(*multierror.Error); ok {
+				errs = merr.Errors
+			}
+			if len(errs) != tc.errors {
+				t.Fatalf("expected %d error(s), got %v", tc.errors, err)
+			}
+			for _, err := range errs {
+				if jerr, ok := err.(JobError); !ok || jerr.Repo != "org/repo" || jerr.Job != "unit" {
+					t.Errorf("expected a JobError for org/repo unit, got %#v", err)
+				}
+			}
+		})
+	}
+}
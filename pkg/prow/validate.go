@@ -0,0 +1,305 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	prowapi "k8s.io/test-infra/prow/config"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultProwConfig is the Prow configuration used for validation when none is provided.
+const defaultProwConfig = `
+pod_namespace: test-pods
+plank:
+  default_decoration_configs:
+    '*':
+      timeout: 2h
+      grace_period: 15s
+      utility_images:
+        clonerefs: clonerefs
+        initupload: initupload
+        entrypoint: entrypoint
+        sidecar: sidecar
+      gcs_configuration:
+        bucket: bucket
+        path_strategy: explicit
+      gcs_credentials_secret: gcs-credentials
+`
+
+// JobError is a problem found with a single job while validating a job configuration. Repo is empty when the
+// repository of the job is not known. A warning does not make the job invalid.
+type JobError struct {
+	Repo    string
+	Job     string
+	Err     error
+	Warning bool
+}
+
+func (e JobError) Error() string {
+	return e.Err.Error()
+}
+
+// jobErrorPatterns match the name of the job in the errors of Prow's config loader.
+var jobErrorPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?:invalid|duplicated) (?:presubmit|postsubmit|periodic) job\s*:?\s*([^\s:]+)`),
+	regexp.MustCompile(`(?:cron and interval cannot be both (?:set|empty)|invalid cron string .*) in periodic ([^\s:]+)`),
+	regexp.MustCompile(`cannot parse duration for ([^\s:]+):`),
+	regexp.MustCompile(`(?i)invalid job ([^\s:]+) on repo ([^\s:]+):`),
+	regexp.MustCompile(`job ([^\s:]+) failed to merge presets`),
+	regexp.MustCompile(`for job ([^\s:,]+),`),
+	regexp.MustCompile(`(?:regex|regexes) for ([^\s:]+):`),
+}
+
+// Validate loads a job configuration through Prow's config loader, applying the same defaulting and validation
+// Prow applies before accepting jobs. Errors which Prow attributes to a job are returned as a JobError.
+//
+// Prow stops validating postsubmits and periodics at the first invalid job, so every job found invalid is removed
+// and the remaining jobs are loaded again. The configuration is loaded once, plus once for every round of invalid
+// jobs.
+func Validate(jobConfig prowapi.JobConfig, prowConfig string) error {
+	var errorList error
+
+	for _, base := range jobBases(jobConfig) {
+		if base.Spec == nil {
+			continue
+		}
+		for i, c := range base.Spec.Containers {
+			if c.Image == "" {
+				err := fmt.Errorf("invalid job %s: containers[%d]: image must be specified", base.Name, i)
+				errorList = multierror.Append(errorList, JobError{Repo: base.Repo, Job: base.Name, Err: err})
+			}
+		}
+	}
+
+	// The Prow version validated against rejects pod specs with several containers or init containers, which Prow
+	// accepts since. The rest of such jobs is validated with their first container only.
+	jobConfig = filterJobs(jobConfig, func(repo string, base *prowapi.JobBase) bool {
+		if base.Spec == nil || (len(base.Spec.Containers) <= 1 && len(base.Spec.InitContainers) == 0) {
+			return true
+		}
+
+		err := fmt.Errorf("pod spec with %d container(s) and %d init container(s) is not supported by the Prow version "+
+			"used for validation; only the first container was validated", len(base.Spec.Containers), len(base.Spec.InitContainers))
+		errorList = multierror.Append(errorList, JobError{Repo: repo, Job: base.Name, Err: err, Warning: true})
+
+		spec := *base.Spec
+		spec.Containers = spec.Containers[:1]
+		spec.InitContainers = nil
+		base.Spec = &spec
+		return true
+	})
+
+	dir, err := ioutil.TempDir("", "pj")
+	if err != nil {
+		return errors.Wrapf(err, "creating temporary directory")
+	}
+	defer os.RemoveAll(dir)
+
+	if prowConfig == "" {
+		prowConfig = filepath.Join(dir, "config.yaml")
+		if err := ioutil.WriteFile(prowConfig, []byte(defaultProwConfig), 0644); err != nil {
+			return errors.Wrapf(err, "writing prow config: %s", prowConfig)
+		}
+	}
+
+	var reported = sets.String{}
+
+	for {
+		errs, err := load(jobConfig, prowConfig, filepath.Join(dir, "jobs"))
+		if err != nil {
+			return err
+		}
+
+		var invalid = sets.String{}
+		for _, err := range errs {
+			if reported.Has(err.Error()) {
+				continue
+			}
+			reported.Insert(err.Error())
+
+			if repo, name := jobErrorName(err); name != "" {
+				invalid.Insert(name)
+				err = JobError{Repo: repo, Job: name, Err: err}
+			}
+			errorList = multierror.Append(errorList, err)
+		}
+
+		if invalid.Len() == 0 {
+			return errorList
+		}
+		jobConfig = removeJobs(jobConfig, invalid)
+	}
+}
+
+// load writes a job configuration to a directory and loads it with Prow's config loader, returning the errors it
+// reports.
+func load(jobConfig prowapi.JobConfig, prowConfig, dir string) ([]error, error) {
+	jobConfigYaml, err := yaml.Marshal(jobConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal job config")
+	}
+
+	jobConfigPath := filepath.Join(dir, DefaultOutput)
+	if err := os.MkdirAll(filepath.Dir(jobConfigPath), os.ModePerm); err != nil {
+		return nil, errors.Wrapf(err, "creating directory: %s", jobConfigPath)
+	}
+
+	if err := ioutil.WriteFile(jobConfigPath, jobConfigYaml, 0644); err != nil {
+		return nil, errors.Wrapf(err, "writing job config: %s", jobConfigPath)
+	}
+
+	_, err = prowapi.Load(prowConfig, dir)
+	return flattenErrors(err), nil
+}
+
+// flattenErrors returns the individual errors of nested aggregates.
+func flattenErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+
+	agg, ok := err.(utilerrors.Aggregate)
+	if !ok {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, e := range agg.Errors() {
+		errs = append(errs, flattenErrors(e)...)
+	}
+	return errs
+}
+
+// jobErrorName returns the name of the job an error of Prow's config loader is about, if any, along with its
+// repository if the error names it.
+func jobErrorName(err error) (string, string) {
+	for _, pattern := range jobErrorPatterns {
+		if m := pattern.FindStringSubmatch(err.Error()); m != nil {
+			if len(m) > 2 {
+				return m[2], m[1]
+			}
+			return "", m[1]
+		}
+	}
+	return "", ""
+}
+
+// removeJobs returns a copy of a job configuration without the jobs of the given names.
+func removeJobs(jobConfig prowapi.JobConfig, names sets.String) prowapi.JobConfig {
+	return filterJobs(jobConfig, func(repo string, base *prowapi.JobBase) bool {
+		return !names.Has(base.Name)
+	})
+}
+
+// filterJobs returns a copy of a job configuration with the jobs for which keep returns true. keep may modify the
+// base of the copied job.
+func filterJobs(jobConfig prowapi.JobConfig, keep func(repo string, base *prowapi.JobBase) bool) prowapi.JobConfig {
+	var out = prowapi.JobConfig{
+		PresubmitsStatic:  make(map[string][]prowapi.Presubmit),
+		PostsubmitsStatic: make(map[string][]prowapi.Postsubmit),
+		Presets:           jobConfig.Presets,
+	}
+
+	for repo, jobs := range jobConfig.PresubmitsStatic {
+		for _, job := range jobs {
+			if keep(repo, &job.JobBase) {
+				out.PresubmitsStatic[repo] = append(out.PresubmitsStatic[repo], job)
+			}
+		}
+	}
+
+	for repo, jobs := range jobConfig.PostsubmitsStatic {
+		for _, job := range jobs {
+			if keep(repo, &job.JobBase) {
+				out.PostsubmitsStatic[repo] = append(out.PostsubmitsStatic[repo], job)
+			}
+		}
+	}
+
+	for _, job := range jobConfig.Periodics {
+		if keep("", &job.JobBase) {
+			out.Periodics = append(out.Periodics, job)
+		}
+	}
+
+	return out
+}
+
+// MergeJobConfigs combines multiple job configurations into one.
+func MergeJobConfigs(jobConfigs ...prowapi.JobConfig) prowapi.JobConfig {
+	merged := prowapi.JobConfig{
+		PresubmitsStatic:  make(map[string][]prowapi.Presubmit),
+		PostsubmitsStatic: make(map[string][]prowapi.Postsubmit),
+	}
+
+	for _, jc := range jobConfigs {
+		for repo, jobs := range jc.PresubmitsStatic {
+			merged.PresubmitsStatic[repo] = append(merged.PresubmitsStatic[repo], jobs...)
+		}
+		for repo, jobs := range jc.PostsubmitsStatic {
+			merged.PostsubmitsStatic[repo] = append(merged.PostsubmitsStatic[repo], jobs...)
+		}
+		merged.Periodics = append(merged.Periodics, jc.Periodics...)
+		merged.Presets = append(merged.Presets, jc.Presets...)
+	}
+
+	return merged
+}
+
+// repoJobBase is the base of a job along with the repository it runs against, if any.
+type repoJobBase struct {
+	Repo string
+	prowapi.JobBase
+}
+
+func jobBases(jobConfig prowapi.JobConfig) []repoJobBase {
+	var bases []repoJobBase
+
+	for repo, jobs := range jobConfig.PresubmitsStatic {
+		for _, job := range jobs {
+			bases = append(bases, repoJobBase{Repo: repo, JobBase: job.JobBase})
+		}
+	}
+
+	for repo, jobs := range jobConfig.PostsubmitsStatic {
+		for _, job := range jobs {
+			bases = append(bases, repoJobBase{Repo: repo, JobBase: job.JobBase})
+		}
+	}
+
+	for _, job := range jobConfig.Periodics {
+		bases = append(bases, repoJobBase{JobBase: job.JobBase})
+	}
+
+	return bases
+}
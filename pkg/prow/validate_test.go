@@ -0,0 +1,59 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package prow
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	corev1 "k8s.io/api/core/v1"
+	prowapi "k8s.io/test-infra/prow/config"
+)
+
+func TestValidateMultipleContainers(t *testing.T) {
+	spec := &corev1.PodSpec{
+		Containers:     []corev1.Container{{Image: "golang:1.14", Command: []string{"make"}}, {Name: "redis", Image: "redis:6"}},
+		InitContainers: []corev1.Container{{Name: "fetch", Image: "busybox"}},
+	}
+	jobConfig := prowapi.JobConfig{
+		PresubmitsStatic: map[string][]prowapi.Presubmit{
+			"org/repo": {{JobBase: prowapi.JobBase{Name: "sidecar", Spec: spec}}},
+		},
+	}
+
+	err := Validate(jobConfig, "")
+
+	merr, ok := err.(*multierror.Error)
+	if !ok || len(merr.Errors) != 1 {
+		t.Fatalf("expected a single warning, got %v", err)
+	}
+
+	jerr, ok := merr.Errors[0].(JobError)
+	if !ok || !jerr.Warning || jerr.Job != "sidecar" || jerr.Repo != "org/repo" {
+		t.Errorf("expected a warning for org/repo sidecar, got %#v", merr.Errors[0])
+	}
+
+	if len(spec.Containers) != 2 || len(spec.InitContainers) != 1 {
+		t.Errorf("expected the job config not to be modified, got %+v", spec)
+	}
+}
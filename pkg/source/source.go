@@ -0,0 +1,118 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package source
+
+import (
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is a parsed yaml file used to locate the position of its values.
+type File struct {
+	Path string
+	root *yaml.Node
+}
+
+// Parse parses the yaml content of a file. Content which cannot be parsed yields a File without positions.
+func Parse(path string, b []byte) *File {
+	f := &File{Path: path}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err == nil && len(doc.Content) > 0 {
+		f.root = doc.Content[0]
+	}
+
+	return f
+}
+
+// Position returns the line and column of the value at a path of map keys (string) and list indices (int). Map
+// keys are located at the key itself. If the path cannot be fully resolved the position of the closest parent is
+// returned, or zero if nothing could be located.
+func (f *File) Position(path ...interface{}) (line, column int) {
+	for n := len(path); n > 0; n-- {
+		if pos, _ := child(f.Node(path[:n-1]...), path[n-1]); pos != nil {
+			return pos.Line, pos.Column
+		}
+	}
+
+	if root := f.Node(); root != nil {
+		return root.Line, root.Column
+	}
+	return 0, 0
+}
+
+// Node returns the node at a path of map keys (string) and list indices (int), or nil if there is none.
+func (f *File) Node(path ...interface{}) *yaml.Node {
+	if f == nil || f.root == nil {
+		return nil
+	}
+
+	node := f.root
+	for _, p := range path {
+		if _, node = child(node, p); node == nil {
+			return nil
+		}
+	}
+
+	return node
+}
+
+// child returns the value of a map key (string) or list index (int) of a node, along with the node locating it: the
+// key of a map entry or the list item itself. Both are nil if the node has no such child.
+func child(node *yaml.Node, p interface{}) (pos, value *yaml.Node) {
+	if node == nil {
+		return nil, nil
+	}
+
+	switch k := p.(type) {
+	case string:
+		if node.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == k {
+				return node.Content[i], node.Content[i+1]
+			}
+		}
+	case int:
+		if node.Kind != yaml.SequenceNode || k < 0 || k >= len(node.Content) {
+			return nil, nil
+		}
+		return node.Content[k], node.Content[k]
+	}
+
+	return nil, nil
+}
+
+var lineRegex = regexp.MustCompile(`line (\d+)`)
+
+// ErrorLine returns the line reported by a yaml parsing error, or zero if it does not report one.
+func ErrorLine(err error) int {
+	if m := lineRegex.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return line
+	}
+	return 0
+}
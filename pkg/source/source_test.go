@@ -0,0 +1,74 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package source
+
+import (
+	"testing"
+)
+
+func TestPosition(t *testing.T) {
+	f := Parse("jobs.yaml", []byte(`repo: org/repo
+jobs:
+  - name: unit
+    command: [make]
+  - name: lint
+`))
+
+	tests := []struct {
+		name   string
+		path   []interface{}
+		line   int
+		column int
+	}{
+		{name: "root", path: nil, line: 1, column: 1},
+		{name: "map key", path: []interface{}{"repo"}, line: 1, column: 1},
+		{name: "list item", path: []interface{}{"jobs", 1}, line: 5, column: 5},
+		{name: "nested key", path: []interface{}{"jobs", 0, "command"}, line: 4, column: 5},
+		{name: "list value", path: []interface{}{"jobs", 0, "command", 0}, line: 4, column: 15},
+		{name: "missing key", path: []interface{}{"jobs", 0, "image"}, line: 3, column: 5},
+		{name: "missing index", path: []interface{}{"jobs", 2}, line: 2, column: 1},
+		{name: "key of a list", path: []interface{}{"jobs", "name"}, line: 2, column: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if line, column := f.Position(tc.path...); line != tc.line || column != tc.column {
+				t.Errorf("expected %d:%d, got %d:%d", tc.line, tc.column, line, column)
+			}
+		})
+	}
+}
+
+func TestNode(t *testing.T) {
+	f := Parse("jobs.yaml", []byte(`jobs: [{name: unit}]`))
+
+	if n := f.Node("jobs", 0, "name"); n == nil || n.Value != "unit" {
+		t.Errorf("expected the name of the first job, got %v", n)
+	}
+	if n := f.Node("jobs", 1); n != nil {
+		t.Errorf("expected no node, got %v", n)
+	}
+	if n := Parse("jobs.yaml", []byte(`: :`)).Node(); n != nil {
+		t.Errorf("expected no node for an unparsable file, got %v", n)
+	}
+}
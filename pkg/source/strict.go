@@ -0,0 +1,230 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package source
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	strutil "github.com/clarketm/pj/pkg/strings"
+)
+
+// UnknownField is a key in a yaml file that does not correspond to any field of the type it is decoded into.
+type UnknownField struct {
+	Path       string
+	Key        string
+	Suggestion string
+	Line       int
+	Column     int
+}
+
+func (u UnknownField) Error() string {
+	msg := fmt.Sprintf("unknown field %q", u.Path)
+	if u.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", u.Suggestion)
+	}
+	return msg
+}
+
+// FieldDecoder is implemented by types which decode themselves, but decode a mapping into their own json fields,
+// so the keys of their object form can still be checked.
+type FieldDecoder interface {
+	DecodesFields()
+}
+
+var (
+	fieldDecoder    = reflect.TypeOf((*FieldDecoder)(nil)).Elem()
+	jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// UnknownFields returns every key in the file which would be ignored when decoding it into a value of type t
+// using its json field names.
+func (f *File) UnknownFields(t reflect.Type) []UnknownField {
+	if f == nil || f.root == nil {
+		return nil
+	}
+	return unknownFields(f.root, t, "")
+}
+
+func unknownFields(node *yaml.Node, t reflect.Type, path string) []UnknownField {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	// Types decoding themselves cannot be checked by field name, unless they decode mappings into their fields.
+	decoder := reflect.PtrTo(t).Implements(jsonUnmarshaler) || reflect.PtrTo(t).Implements(textUnmarshaler)
+	if decoder && !reflect.PtrTo(t).Implements(fieldDecoder) {
+		return nil
+	}
+
+	var unknown []UnknownField
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		fields := JSONFields(t)
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			p := joinPath(path, key.Value)
+
+			field, exists := lookupField(fields, key.Value)
+			if !exists {
+				unknown = append(unknown, UnknownField{
+					Path:       p,
+					Key:        key.Value,
+					Suggestion: strutil.Closest(key.Value, fieldNames(fields)),
+					Line:       key.Line,
+					Column:     key.Column,
+				})
+				continue
+			}
+
+			unknown = append(unknown, unknownFields(value, field, p)...)
+		}
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			unknown = append(unknown, unknownFields(node.Content[i+1], t.Elem(), joinPath(path, node.Content[i].Value))...)
+		}
+
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return nil
+		}
+
+		for i, item := range node.Content {
+			unknown = append(unknown, unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	return unknown
+}
+
+// JSONFields returns the types of the fields of a struct by json name, following the rules encoding/json uses
+// for embedded structs: the shallowest field wins and fields ambiguous at the same depth are ignored.
+func JSONFields(t reflect.Type) map[string]reflect.Type {
+	type field struct {
+		typ   reflect.Type
+		depth int
+		count int
+	}
+
+	found := make(map[string]*field)
+
+	var walk func(t reflect.Type, depth int)
+	walk = func(t reflect.Type, depth int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+
+			name := strings.Split(tag, ",")[0]
+
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				walk(ft, depth+1)
+				continue
+			}
+
+			if sf.PkgPath != "" {
+				continue
+			}
+
+			if name == "" {
+				name = sf.Name
+			}
+
+			switch f, exists := found[name]; {
+			case !exists || depth < f.depth:
+				found[name] = &field{typ: sf.Type, depth: depth, count: 1}
+			case depth == f.depth:
+				f.count++
+			}
+		}
+	}
+	walk(t, 0)
+
+	fields := make(map[string]reflect.Type)
+	for name, f := range found {
+		if f.count == 1 {
+			fields[name] = f.typ
+		}
+	}
+
+	return fields
+}
+
+// lookupField finds a field by name, falling back to the case-insensitive match encoding/json also accepts.
+func lookupField(fields map[string]reflect.Type, name string) (reflect.Type, bool) {
+	if t, exists := fields[name]; exists {
+		return t, true
+	}
+	for n, t := range fields {
+		if strings.EqualFold(n, name) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func fieldNames(fields map[string]reflect.Type) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,161 @@
+/*
+ Copyright © 2020 Travis Clarke <travis.m.clarke@gmail.com>
+
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files (the "Software"), to deal
+ in the Software without restriction, including without limitation the rights
+ to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ copies of the Software, and to permit persons to whom the Software is
+ furnished to do so, subject to the following conditions:
+
+ The above copyright notice and this permission notice shall be included in
+ all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ THE SOFTWARE.
+*/
+
+package source
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type strictBase struct {
+	Image string `json:"image,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+type strictShadow struct {
+	Name string `json:"name,omitempty"`
+}
+
+type strictRef struct {
+	Ref string
+}
+
+func (r *strictRef) UnmarshalJSON(b []byte) error { return json.Unmarshal(b, &r.Ref) }
+
+type strictRepo struct {
+	Repo string `json:"repo,omitempty"`
+}
+
+func (r *strictRepo) UnmarshalJSON(b []byte) error { return nil }
+
+func (strictRepo) DecodesFields() {}
+
+type strictJob struct {
+	strictBase
+	Container struct {
+		Args []string `json:"args,omitempty"`
+	} `json:"container,omitempty"`
+	Labels   map[string]string        `json:"labels,omitempty"`
+	Children []strictJob              `json:"children,omitempty"`
+	Nested   map[string]strictBase    `json:"nested,omitempty"`
+	Ref      *strictRef               `json:"ref,omitempty"`
+	Repos    []strictRepo             `json:"repos,omitempty"`
+	Ignored  string                   `json:"-"`
+	Extra    map[string]*strictShadow `json:"extra,omitempty"`
+}
+
+func TestUnknownFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected []UnknownField
+	}{
+		{
+			name: "known fields",
+			yaml: "image: golang\nname: unit\ncontainer: {args: [-v]}\nlabels: {anything: goes}\n",
+		},
+		{
+			name:     "unknown field with suggestion",
+			yaml:     "imge: golang\n",
+			expected: []UnknownField{{Path: "imge", Key: "imge", Suggestion: "image", Line: 1, Column: 1}},
+		},
+		{
+			name:     "unknown field without suggestion",
+			yaml:     "name: unit\nzzzzzzzzzz: 1\n",
+			expected: []UnknownField{{Path: "zzzzzzzzzz", Key: "zzzzzzzzzz", Line: 2, Column: 1}},
+		},
+		{
+			name:     "case-insensitive match",
+			yaml:     "Image: golang\n",
+			expected: nil,
+		},
+		{
+			name:     "nested struct",
+			yaml:     "container:\n  arg: [-v]\n",
+			expected: []UnknownField{{Path: "container.arg", Key: "arg", Suggestion: "args", Line: 2, Column: 3}},
+		},
+		{
+			name:     "list items",
+			yaml:     "children:\n- name: a\n- nme: b\n",
+			expected: []UnknownField{{Path: "children[1].nme", Key: "nme", Suggestion: "name", Line: 3, Column: 3}},
+		},
+		{
+			name:     "map values",
+			yaml:     "nested:\n  a: {imag: x}\n",
+			expected: []UnknownField{{Path: "nested.a.imag", Key: "imag", Suggestion: "image", Line: 2, Column: 7}},
+		},
+		{
+			name: "type decoding itself",
+			yaml: "ref: {anything: goes}\n",
+		},
+		{
+			name:     "type decoding its fields",
+			yaml:     "repos:\n- {repo: org/repo, rpo: x}\n",
+			expected: []UnknownField{{Path: "repos[0].rpo", Key: "rpo", Suggestion: "repo", Line: 2, Column: 20}},
+		},
+		{
+			name:     "ignored field",
+			yaml:     "Ignored: x\n",
+			expected: []UnknownField{{Path: "Ignored", Key: "Ignored", Line: 1, Column: 1}},
+		},
+		{
+			name:     "alias",
+			yaml:     "base: &base {imge: x}\nchildren: [*base]\n",
+			expected: []UnknownField{{Path: "base", Key: "base", Suggestion: "name", Line: 1, Column: 1}, {Path: "children[0].imge", Key: "imge", Suggestion: "image", Line: 1, Column: 14}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			unknown := Parse("jobs.yaml", []byte(tc.yaml)).UnknownFields(reflect.TypeOf(strictJob{}))
+			if !reflect.DeepEqual(unknown, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, unknown)
+			}
+		})
+	}
+}
+
+func TestJSONFields(t *testing.T) {
+	type inner struct {
+		Shared string
+		Deep   string `json:"deep"`
+	}
+	type other struct {
+		Shared string
+	}
+	type outer struct {
+		inner
+		*other
+		Deep    string `json:"deep,omitempty"`
+		Own     string
+		Skipped string `json:"-"`
+		private string
+	}
+
+	// Shared is ambiguous at the same depth, the shallowest deep wins and unexported or skipped fields are left out.
+	expected := map[string]reflect.Type{"deep": reflect.TypeOf(""), "Own": reflect.TypeOf("")}
+	if fields := JSONFields(reflect.TypeOf(outer{})); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected %v, got %v", expected, fields)
+	}
+}